@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/yolocs/artifact-registry-cred-helper/pkg/commands"
@@ -23,5 +25,14 @@ func main() {
 }
 
 func realMain(ctx context.Context) error {
-	return commands.Run(ctx, os.Args[1:]) //nolint:wrapcheck // Want passthrough
+	args := os.Args[1:]
+
+	// When installed as a Docker credential helper, e.g. as
+	// docker-credential-artifact-registry, speak the Docker protocol.
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	if strings.HasPrefix(name, "docker-credential-") {
+		args = append([]string{"docker-credential"}, args...)
+	}
+
+	return commands.Run(ctx, args) //nolint:wrapcheck // Want passthrough
 }
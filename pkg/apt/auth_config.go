@@ -18,13 +18,30 @@ type AuthConfig struct {
 	config *netrc.NetRC
 }
 
+// Open reads the auth config file without locking it. Use OpenLocked to
+// update the file.
 func Open(configName string) (*AuthConfig, error) {
+	return open(configName, netrc.Open)
+}
+
+// OpenLocked is like Open, but holds an exclusive lock on the file until Close
+// or Discard.
+func OpenLocked(configName string) (*AuthConfig, error) {
+	return open(configName, netrc.OpenLocked)
+}
+
+// ConfigPath returns the path of the auth config file of the name under
+// /etc/apt/auth.conf.d, or of artifact-registry.conf if the name is empty.
+func ConfigPath(configName string) string {
 	if configName == "" {
 		configName = "artifact-registry.conf"
 	}
+	return filepath.Join(configDir, configName)
+}
 
-	configPath := filepath.Join(configDir, configName)
-	config, err := netrc.Open(configPath)
+func open(configName string, openNetRC func(string) (*netrc.NetRC, error)) (*AuthConfig, error) {
+	configPath := ConfigPath(configName)
+	config, err := openNetRC(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open apt auth config file (as netrc) at %q: %w", configPath, err)
 	}
@@ -32,10 +49,48 @@ func Open(configName string) (*AuthConfig, error) {
 	return &AuthConfig{config: config}, nil
 }
 
+// Redact returns the content with the password and account values replaced
+// with the mask, see netrc.NetRC.Redact.
+func (c *AuthConfig) Redact(content []byte, mask string) []byte {
+	return c.config.Redact(content, mask)
+}
+
+// Path returns the path of the auth config file.
+func (c *AuthConfig) Path() string {
+	return c.config.Path()
+}
+
+// Original returns the content of the file when opened.
+func (c *AuthConfig) Original() []byte {
+	return c.config.Original()
+}
+
+// Marshal returns the content Close writes.
+func (c *AuthConfig) Marshal() ([]byte, error) {
+	return c.config.Marshal()
+}
+
+// Close writes the file and releases the lock if any.
 func (c *AuthConfig) Close() error {
 	return c.config.Close()
 }
 
+// Discard releases the lock if any without writing the file.
+func (c *AuthConfig) Discard() error {
+	return c.config.Discard()
+}
+
+// SetMerge sets whether SetToken and SetJSONKey only replace the entries of
+// the given hosts.
+func (c *AuthConfig) SetMerge(merge bool) {
+	c.config.SetMerge(merge)
+}
+
+// Refresh replaces the existing access tokens in place.
+func (c *AuthConfig) Refresh(token string) {
+	c.config.Refresh(token)
+}
+
 func (c *AuthConfig) SetToken(hosts []string, token string) {
 	c.config.SetToken(hosts, token)
 }
@@ -43,3 +98,14 @@ func (c *AuthConfig) SetToken(hosts []string, token string) {
 func (c *AuthConfig) SetJSONKey(hosts []string, base64Key string) {
 	c.config.SetJSONKey(hosts, base64Key)
 }
+
+// Remove removes the credentials of the given hosts, or all of them if no host
+// is given.
+func (c *AuthConfig) Remove(hosts []string) {
+	c.config.Remove(hosts)
+}
+
+// Credentials returns the Artifact Registry entries in order.
+func (c *AuthConfig) Credentials() []netrc.Credential {
+	return c.config.Credentials()
+}
@@ -3,54 +3,167 @@ package auth
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2/google"
 )
 
-// applicationDefault returns a token of Application Default Credentials.
-func applicationDefault(ctx context.Context) (string, error) {
-	creds, err := google.FindDefaultCredentials(ctx, "https://www.googleapis.com/auth/cloud-platform")
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Token is an OAuth2 access token.
+type Token struct {
+	// Value is the access token.
+	Value string
+	// Expiry is when the token expires. A zero expiry means unknown.
+	Expiry time.Time
+	// Source is the name of the provider that produced the token.
+	Source string
+}
+
+// TokenProvider provides access tokens.
+type TokenProvider interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenProviderFunc adapts a function to a TokenProvider.
+type TokenProviderFunc func(ctx context.Context) (*Token, error)
+
+// Token implements TokenProvider.
+func (f TokenProviderFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// ApplicationDefault provides tokens of Application Default Credentials.
+type ApplicationDefault struct{}
+
+// Token implements TokenProvider.
+func (ApplicationDefault) Token(ctx context.Context) (*Token, error) {
+	creds, err := google.FindDefaultCredentials(ctx, cloudPlatformScope)
 	if err != nil {
-		return "", fmt.Errorf("ApplicationDefault: %w", err)
+		return nil, fmt.Errorf("ApplicationDefault: %w", err)
 	}
 	tk, err := creds.TokenSource.Token()
 	if err != nil {
-		return "", fmt.Errorf("ApplicationDefault: %w", err)
+		return nil, fmt.Errorf("ApplicationDefault: %w", err)
 	}
-	return tk.AccessToken, nil
+	return &Token{Value: tk.AccessToken, Expiry: tk.Expiry, Source: "application-default"}, nil
 }
 
-// gcloud returns a token by running `gcloud auth print-access-token` is a separate process.
-// This only works as a fall-back option.
-func gcloud(ctx context.Context) (string, error) {
-	gcloud := "gcloud"
-	if runtime.GOOS == "windows" {
-		gcloud = "gcloud.cmd"
+// GCloud provides tokens by running `gcloud auth print-access-token` in a
+// separate process. This only works as a fall-back option.
+type GCloud struct {
+	// Path is the gcloud executable. Default to gcloud in PATH.
+	Path string
+}
+
+// Token implements TokenProvider.
+func (g GCloud) Token(ctx context.Context) (*Token, error) {
+	gcloud := g.Path
+	if gcloud == "" {
+		gcloud = "gcloud"
+		if runtime.GOOS == "windows" {
+			gcloud = "gcloud.cmd"
+		}
+	}
+	cmd := exec.CommandContext(ctx, gcloud, "auth", "print-access-token", "--format=json")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gcloud: %w", err)
 	}
-	cmd := exec.CommandContext(ctx, gcloud, "auth", "print-access-token")
-	token, err := cmd.Output()
+	tk, err := parseGCloudOutput(out)
 	if err != nil {
-		return "", fmt.Errorf("gcloud: %v", err)
+		return nil, fmt.Errorf("gcloud: %w", err)
 	}
-	return string(token), nil
+	return tk, nil
 }
 
-// Token returns oauth2 access token from the environment. It looks for Application Default Credentials
-// first and if not found, the credentials of the user logged into gcloud.
-func Token(ctx context.Context) (string, error) {
-	token, adcErr := applicationDefault(ctx)
-	if adcErr != nil {
-		var gcloudErr error
-		token, gcloudErr = gcloud(ctx)
-		if gcloudErr != nil {
-			return "", fmt.Errorf("failed to find Application Default Credentials: %w and gcloud credentials %w", adcErr, gcloudErr)
+// parseGCloudOutput parses the output of `gcloud auth print-access-token
+// --format=json`. Older gcloud versions ignore the format and print the bare
+// token, in which case the expiry is unknown.
+func parseGCloudOutput(out []byte) (*Token, error) {
+	s := strings.TrimSpace(string(out))
+	if !strings.HasPrefix(s, "{") {
+		if s == "" {
+			return nil, fmt.Errorf("empty access token")
+		}
+		return &Token{Value: s, Source: "gcloud"}, nil
+	}
+
+	var v struct {
+		Token       string `json:"token"`
+		TokenExpiry string `json:"token_expiry"`
+	}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("failed to parse output: %w", err)
+	}
+	if v.Token == "" {
+		return nil, fmt.Errorf("empty access token")
+	}
+
+	tk := &Token{Value: v.Token, Source: "gcloud"}
+	if v.TokenExpiry != "" {
+		// gcloud prints the expiry in UTC, with or without the zone.
+		expiry, err := time.Parse(time.RFC3339Nano, v.TokenExpiry)
+		if err != nil {
+			expiry, err = time.Parse("2006-01-02T15:04:05.999999999", v.TokenExpiry)
 		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token expiry %q: %w", v.TokenExpiry, err)
+		}
+		tk.Expiry = expiry
+	}
+	return tk, nil
+}
+
+// Env provides tokens from an env var, which is useful when it's another
+// process that produces the access token.
+type Env struct {
+	// Name is the env var name.
+	Name string
+}
+
+// Token implements TokenProvider.
+func (e Env) Token(ctx context.Context) (*Token, error) {
+	v := os.Getenv(e.Name)
+	if v == "" {
+		return nil, fmt.Errorf("failed to get access token from env var %q", e.Name)
+	}
+	return &Token{Value: v, Source: "env"}, nil
+}
+
+// Static provides the same token every time.
+type Static struct {
+	Value  string
+	Expiry time.Time
+}
+
+// Token implements TokenProvider.
+func (s Static) Token(ctx context.Context) (*Token, error) {
+	return &Token{Value: s.Value, Expiry: s.Expiry, Source: "static"}, nil
+}
+
+// Default provides tokens from the environment. It looks for Application
+// Default Credentials first and if not found, the credentials of the user
+// logged into gcloud.
+type Default struct{}
+
+// Token implements TokenProvider.
+func (Default) Token(ctx context.Context) (*Token, error) {
+	tk, adcErr := ApplicationDefault{}.Token(ctx)
+	if adcErr == nil {
+		return tk, nil
+	}
+	tk, gcloudErr := GCloud{}.Token(ctx)
+	if gcloudErr != nil {
+		return nil, fmt.Errorf("failed to find Application Default Credentials: %w and gcloud credentials %w", adcErr, gcloudErr)
 	}
-	return token, nil
+	return tk, nil
 }
 
 // EncodeJSONKey base64 encodes a service account JSON key file.
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseGCloudOutput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		out     string
+		want    *Token
+		wantErr string
+	}{
+		{
+			name: "json with expiry",
+			out:  `{"token": "ya29.token", "token_expiry": "2025-01-02T03:04:05Z"}` + "\n",
+			want: &Token{Value: "ya29.token", Expiry: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), Source: "gcloud"},
+		},
+		{
+			name: "json with expiry without zone",
+			out:  `{"token": "ya29.token", "token_expiry": "2025-01-02T03:04:05.123456"}`,
+			want: &Token{Value: "ya29.token", Expiry: time.Date(2025, 1, 2, 3, 4, 5, 123456000, time.UTC), Source: "gcloud"},
+		},
+		{
+			name: "json without expiry",
+			out:  `{"token": "ya29.token"}`,
+			want: &Token{Value: "ya29.token", Source: "gcloud"},
+		},
+		{
+			name: "bare token with trailing newline",
+			out:  "ya29.token\n",
+			want: &Token{Value: "ya29.token", Source: "gcloud"},
+		},
+		{
+			name:    "empty",
+			out:     "\n",
+			wantErr: "empty access token",
+		},
+		{
+			name:    "json without token",
+			out:     `{"token_expiry": "2025-01-02T03:04:05Z"}`,
+			wantErr: "empty access token",
+		},
+		{
+			name:    "bad expiry",
+			out:     `{"token": "ya29.token", "token_expiry": "tomorrow"}`,
+			wantErr: `failed to parse token expiry "tomorrow"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseGCloudOutput([]byte(tc.out))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("unexpected error: %s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("token (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// Disable parallel due to setting env vars.
+func TestEnv_Token(t *testing.T) {
+	t.Setenv("TEST_AUTH_TOKEN", "env-token")
+
+	got, err := Env{Name: "TEST_AUTH_TOKEN"}.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(&Token{Value: "env-token", Source: "env"}, got); diff != "" {
+		t.Errorf("token (-want,+got):\n%s", diff)
+	}
+
+	_, err = Env{Name: "TEST_AUTH_TOKEN_NOT_SET"}.Token(context.Background())
+	if diff := testutil.DiffErrString(err, `failed to get access token from env var "TEST_AUTH_TOKEN_NOT_SET"`); diff != "" {
+		t.Errorf("unexpected error: %s", diff)
+	}
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// AccessBoundaryRule is a rule of a Credential Access Boundary, see
+// https://cloud.google.com/iam/docs/downscoping-short-lived-credentials.
+type AccessBoundaryRule struct {
+	// AvailableResource is the full resource name, e.g.
+	// //artifactregistry.googleapis.com/projects/[project]/locations/[location]/repositories/[repo].
+	AvailableResource string `json:"availableResource"`
+	// AvailablePermissions are the upper bound of the permissions on the
+	// resource, e.g. inRole:roles/artifactregistry.reader.
+	AvailablePermissions []string `json:"availablePermissions"`
+}
+
+// Downscope provides tokens restricted by a Credential Access Boundary, by
+// exchanging the base token at the Security Token Service.
+type Downscope struct {
+	// Base provides the token to downscope.
+	Base TokenProvider
+	// Rules are the rules of the Credential Access Boundary.
+	Rules []AccessBoundaryRule
+	// STSEndpoint overrides DefaultSTSEndpoint.
+	STSEndpoint string
+	// Client is the HTTP client. Default to http.DefaultClient.
+	Client *http.Client
+}
+
+// Token implements TokenProvider.
+func (d *Downscope) Token(ctx context.Context) (*Token, error) {
+	if len(d.Rules) == 0 {
+		return nil, fmt.Errorf("Downscope: no access boundary rules")
+	}
+
+	base, err := d.Base.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Downscope: failed to get base token: %w", err)
+	}
+
+	var boundary struct {
+		AccessBoundary struct {
+			AccessBoundaryRules []AccessBoundaryRule `json:"accessBoundaryRules"`
+		} `json:"accessBoundary"`
+	}
+	boundary.AccessBoundary.AccessBoundaryRules = d.Rules
+	options, err := json.Marshal(&boundary)
+	if err != nil {
+		return nil, fmt.Errorf("Downscope: failed to encode access boundary: %w", err)
+	}
+
+	tk, err := exchangeToken(ctx, d.Client, d.STSEndpoint, url.Values{
+		"requested_token_type": {accessTokenType},
+		"subject_token":        {base.Value},
+		"subject_token_type":   {accessTokenType},
+		"options":              {string(options)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Downscope: %w", err)
+	}
+
+	// The downscoped token can't outlive the base token.
+	if tk.Expiry.IsZero() || (!base.Expiry.IsZero() && base.Expiry.Before(tk.Expiry)) {
+		tk.Expiry = base.Expiry
+	}
+	tk.Source = "downscoped"
+	return tk, nil
+}
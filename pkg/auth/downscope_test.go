@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDownscope_Token(t *testing.T) {
+	t.Parallel()
+
+	rules := []AccessBoundaryRule{{
+		AvailableResource:    "//artifactregistry.googleapis.com/projects/proj/locations/us/repositories/repo",
+		AvailablePermissions: []string{"inRole:roles/artifactregistry.reader"},
+	}}
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("subject_token") != "base-token" || r.PostForm.Get("subject_token_type") != accessTokenType {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		var options struct {
+			AccessBoundary struct {
+				AccessBoundaryRules []AccessBoundaryRule `json:"accessBoundaryRules"`
+			} `json:"accessBoundary"`
+		}
+		if err := json.Unmarshal([]byte(r.PostForm.Get("options")), &options); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if diff := cmp.Diff(rules, options.AccessBoundary.AccessBoundaryRules); diff != "" {
+			http.Error(w, "rules (-want,+got): "+diff, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"downscoped-token","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer"}`)
+	}))
+	t.Cleanup(sts.Close)
+
+	baseExpiry := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+
+	tests := []struct {
+		name    string
+		base    TokenProvider
+		rules   []AccessBoundaryRule
+		want    *Token
+		wantErr string
+	}{
+		{
+			name:  "success",
+			base:  Static{Value: "base-token", Expiry: baseExpiry},
+			rules: rules,
+			want:  &Token{Value: "downscoped-token", Expiry: baseExpiry, Source: "downscoped"},
+		},
+		{
+			name:    "exchange failure",
+			base:    Static{Value: "other-token"},
+			rules:   rules,
+			wantErr: "invalid_grant",
+		},
+		{
+			name:    "no rules",
+			base:    Static{Value: "base-token"},
+			wantErr: "no access boundary rules",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			d := &Downscope{Base: tc.base, Rules: tc.rules, STSEndpoint: sts.URL}
+			got, err := d.Token(context.Background())
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("Token() unexpected error: %s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Token() (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
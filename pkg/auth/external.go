@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	externalAccountType = "external_account"
+
+	// allowExecutablesEnv must be set to 1 to run executables of credential
+	// configurations, the same as the Google client libraries.
+	allowExecutablesEnv = "GOOGLE_EXTERNAL_ACCOUNT_ALLOW_EXECUTABLES"
+
+	defaultExecutableTimeout = 30 * time.Second
+)
+
+// externalAccountConfig is a credential configuration file of Workload
+// Identity Federation, see
+// https://google.aip.dev/auth/4117.
+type externalAccountConfig struct {
+	Type                           string           `json:"type"`
+	Audience                       string           `json:"audience"`
+	SubjectTokenType               string           `json:"subject_token_type"`
+	TokenURL                       string           `json:"token_url"`
+	ServiceAccountImpersonationURL string           `json:"service_account_impersonation_url"`
+	CredentialSource               credentialSource `json:"credential_source"`
+}
+
+type credentialSource struct {
+	File       string                 `json:"file"`
+	URL        string                 `json:"url"`
+	Headers    map[string]string      `json:"headers"`
+	Executable *executableConfig      `json:"executable"`
+	Format     credentialSourceFormat `json:"format"`
+}
+
+type credentialSourceFormat struct {
+	// Type is either "text" (default) or "json".
+	Type                  string `json:"type"`
+	SubjectTokenFieldName string `json:"subject_token_field_name"`
+}
+
+type executableConfig struct {
+	Command       string `json:"command"`
+	TimeoutMillis int64  `json:"timeout_millis"`
+	OutputFile    string `json:"output_file"`
+}
+
+// executableResponse is the output of a credential configuration executable.
+type executableResponse struct {
+	Version        int    `json:"version"`
+	Success        *bool  `json:"success"`
+	TokenType      string `json:"token_type"`
+	ExpirationTime int64  `json:"expiration_time"`
+	IDToken        string `json:"id_token"`
+	SAMLResponse   string `json:"saml_response"`
+	Code           string `json:"code"`
+	Message        string `json:"message"`
+}
+
+// ExternalAccount provides tokens of an external_account credential
+// configuration for Workload Identity Federation, by exchanging the subject
+// token from the credential source at the Security Token Service. If the
+// configuration has a service_account_impersonation_url, the federated token
+// is then used to impersonate the service account.
+type ExternalAccount struct {
+	// ConfigPath is the path to the credential configuration file.
+	ConfigPath string
+	// STSEndpoint overrides the token_url of the configuration.
+	STSEndpoint string
+	// Client is the HTTP client. Default to http.DefaultClient.
+	Client *http.Client
+}
+
+// Token implements TokenProvider.
+func (e *ExternalAccount) Token(ctx context.Context) (*Token, error) {
+	cfg, err := e.config()
+	if err != nil {
+		return nil, err
+	}
+
+	subjectToken, err := cfg.CredentialSource.subjectToken(ctx, e.Client, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("ExternalAccount: failed to get subject token: %w", err)
+	}
+
+	endpoint := e.STSEndpoint
+	if endpoint == "" {
+		endpoint = cfg.TokenURL
+	}
+	tk, err := exchangeToken(ctx, e.Client, endpoint, url.Values{
+		"audience":             {cfg.Audience},
+		"scope":                {cloudPlatformScope},
+		"requested_token_type": {accessTokenType},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {cfg.SubjectTokenType},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ExternalAccount: %w", err)
+	}
+
+	if cfg.ServiceAccountImpersonationURL != "" {
+		tk, err = generateAccessToken(ctx, e.Client, cfg.ServiceAccountImpersonationURL, tk.Value, nil)
+		if err != nil {
+			return nil, fmt.Errorf("ExternalAccount: %w", err)
+		}
+	}
+	tk.Source = "external-account"
+	return tk, nil
+}
+
+func (e *ExternalAccount) config() (*externalAccountConfig, error) {
+	b, err := os.ReadFile(e.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("ExternalAccount: %w", err)
+	}
+	var cfg externalAccountConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("ExternalAccount: failed to parse %q: %w", e.ConfigPath, err)
+	}
+
+	var merr error
+	if cfg.Type != externalAccountType {
+		merr = errors.Join(merr, fmt.Errorf("type must be %q, got %q", externalAccountType, cfg.Type))
+	}
+	if cfg.Audience == "" {
+		merr = errors.Join(merr, fmt.Errorf("audience is required"))
+	}
+	if cfg.SubjectTokenType == "" {
+		merr = errors.Join(merr, fmt.Errorf("subject_token_type is required"))
+	}
+	src := cfg.CredentialSource
+	n := 0
+	for _, set := range []bool{src.File != "", src.URL != "", src.Executable != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		merr = errors.Join(merr, fmt.Errorf("credential_source must have exactly one of file, url or executable"))
+	}
+	if merr != nil {
+		return nil, fmt.Errorf("ExternalAccount: invalid credential configuration %q: %w", e.ConfigPath, merr)
+	}
+	return &cfg, nil
+}
+
+func (s *credentialSource) subjectToken(ctx context.Context, client *http.Client, cfg *externalAccountConfig) (string, error) {
+	switch {
+	case s.File != "":
+		b, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		return s.Format.parse(b)
+	case s.URL != "":
+		b, err := s.fetch(ctx, client)
+		if err != nil {
+			return "", err
+		}
+		return s.Format.parse(b)
+	default:
+		return s.Executable.run(ctx, cfg)
+	}
+}
+
+func (s *credentialSource) fetch(ctx context.Context, client *http.Client) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %q: %w", s.URL, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of %q: %w", s.URL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %q: %s", s.URL, resp.Status)
+	}
+	return b, nil
+}
+
+func (f credentialSourceFormat) parse(b []byte) (string, error) {
+	var token string
+	switch f.Type {
+	case "", "text":
+		token = strings.TrimSpace(string(b))
+	case "json":
+		var v map[string]any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return "", fmt.Errorf("failed to parse subject token as JSON: %w", err)
+		}
+		token, _ = v[f.SubjectTokenFieldName].(string)
+	default:
+		return "", fmt.Errorf("unknown format type %q", f.Type)
+	}
+	if token == "" {
+		return "", fmt.Errorf("empty subject token")
+	}
+	return token, nil
+}
+
+func (x *executableConfig) run(ctx context.Context, cfg *externalAccountConfig) (string, error) {
+	if os.Getenv(allowExecutablesEnv) != "1" {
+		return "", fmt.Errorf("executables need to be explicitly allowed by setting %s=1", allowExecutablesEnv)
+	}
+	args := strings.Fields(x.Command)
+	if len(args) == 0 {
+		return "", fmt.Errorf("executable command is required")
+	}
+
+	// Reuse the cached response if it's still valid.
+	if x.OutputFile != "" {
+		if b, err := os.ReadFile(x.OutputFile); err == nil && len(bytes.TrimSpace(b)) > 0 {
+			if token, err := parseExecutableResponse(b, true); err == nil {
+				return token, nil
+			}
+		}
+	}
+
+	timeout := defaultExecutableTimeout
+	if x.TimeoutMillis > 0 {
+		timeout = time.Duration(x.TimeoutMillis) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"GOOGLE_EXTERNAL_ACCOUNT_AUDIENCE="+cfg.Audience,
+		"GOOGLE_EXTERNAL_ACCOUNT_TOKEN_TYPE="+cfg.SubjectTokenType,
+		"GOOGLE_EXTERNAL_ACCOUNT_INTERACTIVE=0",
+	)
+	if x.OutputFile != "" {
+		cmd.Env = append(cmd.Env, "GOOGLE_EXTERNAL_ACCOUNT_OUTPUT_FILE="+x.OutputFile)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run executable %q: %w", x.Command, err)
+	}
+	return parseExecutableResponse(out, x.OutputFile != "")
+}
+
+// parseExecutableResponse returns the subject token of an executable response.
+// The expiration time is required when the response is cached in an output
+// file.
+func parseExecutableResponse(b []byte, requireExpiry bool) (string, error) {
+	var v executableResponse
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", fmt.Errorf("failed to parse executable response: %w", err)
+	}
+	if v.Version != 1 {
+		return "", fmt.Errorf("unsupported executable response version %d", v.Version)
+	}
+	if v.Success == nil {
+		return "", fmt.Errorf("executable response has no success field")
+	}
+	if !*v.Success {
+		return "", fmt.Errorf("executable failed with code %q: %s", v.Code, v.Message)
+	}
+	if v.ExpirationTime == 0 && requireExpiry {
+		return "", fmt.Errorf("executable response has no expiration_time")
+	}
+	if v.ExpirationTime != 0 && time.Unix(v.ExpirationTime, 0).Before(time.Now()) {
+		return "", fmt.Errorf("executable response has expired")
+	}
+
+	var token string
+	switch v.TokenType {
+	case "urn:ietf:params:oauth:token-type:jwt", "urn:ietf:params:oauth:token-type:id_token":
+		token = v.IDToken
+	case "urn:ietf:params:oauth:token-type:saml2":
+		token = v.SAMLResponse
+	default:
+		return "", fmt.Errorf("unsupported executable token type %q", v.TokenType)
+	}
+	if token == "" {
+		return "", fmt.Errorf("empty subject token")
+	}
+	return token, nil
+}
@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeSTS is a stand-in of the Security Token Service that issues an access
+// token for each known subject token.
+func fakeSTS(t *testing.T, subjectTokens map[string]string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got, want := r.PostForm.Get("grant_type"), tokenExchangeGrantType; got != want {
+			http.Error(w, fmt.Sprintf("grant_type = %q, want %q", got, want), http.StatusBadRequest)
+			return
+		}
+		if got, want := r.PostForm.Get("audience"), "//iam.googleapis.com/test-audience"; got != want {
+			http.Error(w, fmt.Sprintf("audience = %q, want %q", got, want), http.StatusBadRequest)
+			return
+		}
+		accessToken, ok := subjectTokens[r.PostForm.Get("subject_token")]
+		if !ok {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&stsResponse{
+			AccessToken:     accessToken,
+			IssuedTokenType: accessTokenType,
+			TokenType:       "Bearer",
+			ExpiresIn:       3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func writeCredentialConfig(t *testing.T, source map[string]any) string {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]any{
+		"type":               "external_account",
+		"audience":           "//iam.googleapis.com/test-audience",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":          "https://sts.invalid/v1/token",
+		"credential_source":  source,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(p, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExternalAccount_Token(t *testing.T) {
+	t.Parallel()
+
+	sts := fakeSTS(t, map[string]string{
+		"file-subject-token": "file-access-token",
+		"url-subject-token":  "url-access-token",
+	})
+
+	subjectTokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"value": "url-subject-token"}`)
+	}))
+	t.Cleanup(subjectTokenServer.Close)
+
+	subjectTokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(subjectTokenFile, []byte("file-subject-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		source    map[string]any
+		wantToken string
+		wantErr   string
+	}{
+		{
+			name:      "file source",
+			source:    map[string]any{"file": subjectTokenFile},
+			wantToken: "file-access-token",
+		},
+		{
+			name: "url source with json format",
+			source: map[string]any{
+				"url":     subjectTokenServer.URL,
+				"headers": map[string]string{"Metadata-Flavor": "Test"},
+				"format":  map[string]string{"type": "json", "subject_token_field_name": "value"},
+			},
+			wantToken: "url-access-token",
+		},
+		{
+			name:    "url source failure",
+			source:  map[string]any{"url": subjectTokenServer.URL},
+			wantErr: "403 Forbidden",
+		},
+		{
+			name:    "unknown subject token",
+			source:  map[string]any{"file": subjectTokenFile, "format": map[string]string{"type": "json", "subject_token_field_name": "value"}},
+			wantErr: "failed to parse subject token as JSON",
+		},
+		{
+			name:    "no source",
+			source:  map[string]any{},
+			wantErr: "credential_source must have exactly one of file, url or executable",
+		},
+		{
+			name:    "executables not allowed",
+			source:  map[string]any{"executable": map[string]any{"command": "/bin/true"}},
+			wantErr: "GOOGLE_EXTERNAL_ACCOUNT_ALLOW_EXECUTABLES=1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			e := &ExternalAccount{
+				ConfigPath:  writeCredentialConfig(t, tc.source),
+				STSEndpoint: sts.URL,
+			}
+			got, err := e.Token(context.Background())
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("Token() unexpected error: %s", diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+			if got.Value != tc.wantToken {
+				t.Errorf("Token() = %q, want %q", got.Value, tc.wantToken)
+			}
+			if got.Source != "external-account" {
+				t.Errorf("Token() source = %q, want %q", got.Source, "external-account")
+			}
+			if d := time.Until(got.Expiry); d < 59*time.Minute || d > time.Hour {
+				t.Errorf("Token() expiry in %v, want about an hour", d)
+			}
+		})
+	}
+}
+
+func TestExternalAccount_Token_impersonation(t *testing.T) {
+	t.Parallel()
+
+	sts := fakeSTS(t, map[string]string{"file-subject-token": "federated-token"})
+
+	iam := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Path, "/v1/projects/-/serviceAccounts/reader@proj.iam.gserviceaccount.com:generateAccessToken"; got != want {
+			http.Error(w, fmt.Sprintf("path = %q, want %q", got, want), http.StatusNotFound)
+			return
+		}
+		if got, want := r.Header.Get("Authorization"), "Bearer federated-token"; got != want {
+			http.Error(w, fmt.Sprintf("Authorization = %q, want %q", got, want), http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"accessToken": "impersonated-token", "expireTime": "2030-01-02T03:04:05Z"}`)
+	}))
+	t.Cleanup(iam.Close)
+
+	subjectTokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(subjectTokenFile, []byte("file-subject-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// As written by gcloud iam workload-identity-pools create-cred-config
+	// --service-account.
+	b, err := json.Marshal(map[string]any{
+		"type":                              "external_account",
+		"audience":                          "//iam.googleapis.com/test-audience",
+		"subject_token_type":                "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":                         sts.URL,
+		"service_account_impersonation_url": iam.URL + "/v1/projects/-/serviceAccounts/reader@proj.iam.gserviceaccount.com:generateAccessToken",
+		"credential_source":                 map[string]any{"file": subjectTokenFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(p, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := (&ExternalAccount{ConfigPath: p}).Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	want := &Token{
+		Value:  "impersonated-token",
+		Expiry: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		Source: "external-account",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Token() (-want,+got):\n%s", diff)
+	}
+}
+
+// Disable parallel due to setting env vars.
+func TestExternalAccount_Token_executable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable test uses a shell script")
+	}
+	t.Setenv(allowExecutablesEnv, "1")
+
+	sts := fakeSTS(t, map[string]string{"exec-subject-token": "exec-access-token"})
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "token.sh")
+	resp := fmt.Sprintf(`{"version": 1, "success": true, "token_type": "urn:ietf:params:oauth:token-type:jwt", "id_token": "exec-subject-token", "expiration_time": %d}`,
+		time.Now().Add(time.Hour).Unix())
+	content := "#!/bin/sh\n" +
+		`[ "$GOOGLE_EXTERNAL_ACCOUNT_AUDIENCE" = "//iam.googleapis.com/test-audience" ] || exit 1` + "\n" +
+		"echo '" + resp + "'\n"
+	if err := os.WriteFile(script, []byte(content), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &ExternalAccount{
+		ConfigPath:  writeCredentialConfig(t, map[string]any{"executable": map[string]any{"command": script, "timeout_millis": 5000}}),
+		STSEndpoint: sts.URL,
+	}
+	got, err := e.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() unexpected error: %v", err)
+	}
+	if got.Value != "exec-access-token" {
+		t.Errorf("Token() = %q, want %q", got.Value, "exec-access-token")
+	}
+}
+
+func TestParseExecutableResponse(t *testing.T) {
+	t.Parallel()
+
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+
+	tests := []struct {
+		name          string
+		resp          string
+		requireExpiry bool
+		want          string
+		wantErr       string
+	}{
+		{
+			name: "jwt",
+			resp: fmt.Sprintf(`{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:jwt","id_token":"jwt-token","expiration_time":%d}`, future),
+			want: "jwt-token",
+		},
+		{
+			name: "saml",
+			resp: `{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:saml2","saml_response":"saml-token"}`,
+			want: "saml-token",
+		},
+		{
+			name:          "expiry required",
+			resp:          `{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:saml2","saml_response":"saml-token"}`,
+			requireExpiry: true,
+			wantErr:       "no expiration_time",
+		},
+		{
+			name:    "expired",
+			resp:    fmt.Sprintf(`{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:jwt","id_token":"jwt-token","expiration_time":%d}`, past),
+			wantErr: "has expired",
+		},
+		{
+			name:    "failure",
+			resp:    `{"version":1,"success":false,"code":"401","message":"not logged in"}`,
+			wantErr: `executable failed with code "401": not logged in`,
+		},
+		{
+			name:    "unsupported version",
+			resp:    `{"version":2,"success":true}`,
+			wantErr: "unsupported executable response version 2",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseExecutableResponse([]byte(tc.resp), tc.requireExpiry)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("unexpected error: %s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("token (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
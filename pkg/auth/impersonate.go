@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultIAMCredentialsEndpoint is the endpoint of the IAM Service Account
+// Credentials API.
+const DefaultIAMCredentialsEndpoint = "https://iamcredentials.googleapis.com"
+
+// Impersonate provides tokens of a service account by calling the IAM
+// Credentials generateAccessToken API with a base token, see
+// https://cloud.google.com/iam/docs/reference/credentials/rest/v1/projects.serviceAccounts/generateAccessToken.
+type Impersonate struct {
+	// Base provides the token of the caller, which must have the Service
+	// Account Token Creator role on the first service account of the chain.
+	Base TokenProvider
+	// ServiceAccount is the email of the service account to impersonate.
+	ServiceAccount string
+	// Delegates is the delegation chain from the caller to the service
+	// account, in order.
+	Delegates []string
+	// Endpoint overrides DefaultIAMCredentialsEndpoint.
+	Endpoint string
+	// Client is the HTTP client. Default to http.DefaultClient.
+	Client *http.Client
+}
+
+// Token implements TokenProvider.
+func (i *Impersonate) Token(ctx context.Context) (*Token, error) {
+	base, err := i.Base.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Impersonate: failed to get base token: %w", err)
+	}
+
+	endpoint := i.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultIAMCredentialsEndpoint
+	}
+	u := strings.TrimSuffix(endpoint, "/") + "/v1/projects/-/serviceAccounts/" + url.PathEscape(i.ServiceAccount) + ":generateAccessToken"
+
+	tk, err := generateAccessToken(ctx, i.Client, u, base.Value, i.Delegates)
+	if err != nil {
+		return nil, fmt.Errorf("Impersonate: %w", err)
+	}
+	return tk, nil
+}
+
+// generateAccessToken calls the generateAccessToken API at the given URL with
+// the base token.
+func generateAccessToken(ctx context.Context, client *http.Client, u, baseToken string, delegates []string) (*Token, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	body := struct {
+		Delegates []string `json:"delegates,omitempty"`
+		Scope     []string `json:"scope"`
+	}{Scope: []string{cloudPlatformScope}}
+	for _, d := range delegates {
+		body.Delegates = append(body.Delegates, "projects/-/serviceAccounts/"+d)
+	}
+	b, err := json.Marshal(&body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode generateAccessToken request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create generateAccessToken request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+baseToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generateAccessToken response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to generate access token: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	var v struct {
+		AccessToken string `json:"accessToken"`
+		ExpireTime  string `json:"expireTime"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse generateAccessToken response: %w", err)
+	}
+	if v.AccessToken == "" {
+		return nil, fmt.Errorf("generateAccessToken response has no access token")
+	}
+
+	tk := &Token{Value: v.AccessToken, Source: "impersonated"}
+	if v.ExpireTime != "" {
+		expiry, err := time.Parse(time.RFC3339Nano, v.ExpireTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse expire time %q: %w", v.ExpireTime, err)
+		}
+		tk.Expiry = expiry
+	}
+	return tk, nil
+}
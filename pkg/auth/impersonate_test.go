@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeIAMCredentials is a stand-in of the IAM Credentials API that issues
+// "impersonated-token" to callers with "base-token".
+func fakeIAMCredentials(t *testing.T, wantPath string, wantDelegates []string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer base-token" {
+			http.Error(w, `{"error":{"code":401}}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != wantPath {
+			http.Error(w, fmt.Sprintf("path = %q, want %q", r.URL.Path, wantPath), http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Delegates []string `json:"delegates"`
+			Scope     []string `json:"scope"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if diff := cmp.Diff(wantDelegates, body.Delegates); diff != "" {
+			http.Error(w, "delegates (-want,+got): "+diff, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"accessToken": "impersonated-token", "expireTime": "2025-01-02T03:04:05Z"}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestImpersonate_Token(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		base              TokenProvider
+		delegates         []string
+		wantPath          string
+		wantBodyDelegates []string
+		want              *Token
+		wantErr           string
+	}{
+		{
+			name:     "success",
+			base:     Static{Value: "base-token"},
+			wantPath: "/v1/projects/-/serviceAccounts/reader@proj.iam.gserviceaccount.com:generateAccessToken",
+			want: &Token{
+				Value:  "impersonated-token",
+				Expiry: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+				Source: "impersonated",
+			},
+		},
+		{
+			name:      "with delegates",
+			base:      Static{Value: "base-token"},
+			delegates: []string{"d1@proj.iam.gserviceaccount.com", "d2@proj.iam.gserviceaccount.com"},
+			wantPath:  "/v1/projects/-/serviceAccounts/reader@proj.iam.gserviceaccount.com:generateAccessToken",
+			wantBodyDelegates: []string{
+				"projects/-/serviceAccounts/d1@proj.iam.gserviceaccount.com",
+				"projects/-/serviceAccounts/d2@proj.iam.gserviceaccount.com",
+			},
+			want: &Token{
+				Value:  "impersonated-token",
+				Expiry: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+				Source: "impersonated",
+			},
+		},
+		{
+			name:     "permission denied",
+			base:     Static{Value: "other-token"},
+			wantPath: "/v1/projects/-/serviceAccounts/reader@proj.iam.gserviceaccount.com:generateAccessToken",
+			wantErr:  "401 Unauthorized",
+		},
+		{
+			name: "base token error",
+			base: TokenProviderFunc(func(context.Context) (*Token, error) {
+				return nil, fmt.Errorf("no credentials")
+			}),
+			wantErr: "failed to get base token: no credentials",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := fakeIAMCredentials(t, tc.wantPath, tc.wantBodyDelegates)
+			i := &Impersonate{
+				Base:           tc.base,
+				ServiceAccount: "reader@proj.iam.gserviceaccount.com",
+				Delegates:      tc.delegates,
+				Endpoint:       srv.URL,
+			}
+			got, err := i.Token(context.Background())
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("Token() unexpected error: %s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Token() (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSTSEndpoint is the token endpoint of the Security Token Service.
+	DefaultSTSEndpoint = "https://sts.googleapis.com/v1/token"
+
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// stsResponse is the response of a successful token exchange, see
+// https://cloud.google.com/iam/docs/reference/sts/rest/v1/TopLevel/token.
+type stsResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+}
+
+// exchangeToken exchanges a token at the Security Token Service endpoint with
+// the given form parameters, in addition to the grant type.
+func exchangeToken(ctx context.Context, client *http.Client, endpoint string, form url.Values) (*Token, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if endpoint == "" {
+		endpoint = DefaultSTSEndpoint
+	}
+
+	form.Set("grant_type", tokenExchangeGrantType)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token exchange request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token exchange response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to exchange token: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	var v stsResponse
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse token exchange response: %w", err)
+	}
+	if v.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange response has no access token")
+	}
+
+	tk := &Token{Value: v.AccessToken, Source: "sts"}
+	if v.ExpiresIn > 0 {
+		tk.Expiry = time.Now().Add(time.Duration(v.ExpiresIn) * time.Second)
+	}
+	return tk, nil
+}
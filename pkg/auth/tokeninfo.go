@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTokenInfoEndpoint is the endpoint of the OAuth2 tokeninfo API.
+const DefaultTokenInfoEndpoint = "https://oauth2.googleapis.com/tokeninfo"
+
+// TokenInfo is what the tokeninfo API knows about an access token.
+type TokenInfo struct {
+	// Email is the email of the principal, if the token has the email scope.
+	Email string
+	// Scopes are the OAuth2 scopes of the token.
+	Scopes []string
+	// Expiry is when the token expires.
+	Expiry time.Time
+}
+
+// GetTokenInfo looks up the access token at the tokeninfo endpoint, which
+// fails if the token is invalid or expired. An empty endpoint means
+// DefaultTokenInfoEndpoint, and a nil client means http.DefaultClient.
+func GetTokenInfo(ctx context.Context, client *http.Client, endpoint, token string) (*TokenInfo, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if endpoint == "" {
+		endpoint = DefaultTokenInfoEndpoint
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint,
+		strings.NewReader(url.Values{"access_token": {token}}.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tokeninfo request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokeninfo response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get token info: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	var v struct {
+		Email string `json:"email"`
+		Scope string `json:"scope"`
+		Exp   string `json:"exp"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse tokeninfo response: %w", err)
+	}
+
+	info := &TokenInfo{Email: v.Email, Scopes: strings.Fields(v.Scope)}
+	if v.Exp != "" {
+		exp, err := strconv.ParseInt(v.Exp, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse exp %q: %w", v.Exp, err)
+		}
+		info.Expiry = time.Unix(exp, 0)
+	}
+	return info, nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetTokenInfo(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch r.PostForm.Get("access_token") {
+		case "valid-token":
+			fmt.Fprint(w, `{"email":"me@example.com","scope":"openid https://www.googleapis.com/auth/cloud-platform","exp":"1735787045","expires_in":"3599"}`)
+		case "bad-exp-token":
+			fmt.Fprint(w, `{"exp":"soon"}`)
+		default:
+			http.Error(w, `{"error":"invalid_token","error_description":"Invalid Value"}`, http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name    string
+		token   string
+		want    *TokenInfo
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			token: "valid-token",
+			want: &TokenInfo{
+				Email:  "me@example.com",
+				Scopes: []string{"openid", "https://www.googleapis.com/auth/cloud-platform"},
+				Expiry: time.Unix(1735787045, 0),
+			},
+		},
+		{
+			name:    "invalid",
+			token:   "expired-token",
+			wantErr: "400 Bad Request",
+		},
+		{
+			name:    "bad exp",
+			token:   "bad-exp-token",
+			wantErr: `failed to parse exp "soon"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := GetTokenInfo(context.Background(), nil, srv.URL, tc.token)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("GetTokenInfo() unexpected error: %s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("GetTokenInfo() (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
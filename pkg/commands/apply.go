@@ -0,0 +1,290 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/maven"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultApplyConfigPath = ".ar-cred-helper.yaml"
+
+// Target types of the apply config.
+const (
+	targetNetRC = "netrc"
+	targetMaven = "maven"
+	targetNPM   = "npm"
+	targetApt   = "apt"
+)
+
+type ApplyCommand struct {
+	baseCommand
+
+	commonFlags *CommonFlags
+	configPath  string
+
+	config *applyConfig
+}
+
+// applyConfig is the config file of the apply command, in YAML or JSON.
+type applyConfig struct {
+	Targets []*applyTarget `yaml:"targets"`
+}
+
+// applyTarget is a config file to write the credential of the repos to, like
+// the set-* command of its type does.
+type applyTarget struct {
+	// Type is one of netrc, maven, npm or apt.
+	Type string `yaml:"type"`
+	// Repos are the repo URLs in format '*.pkg.dev/[project]/[repo]'.
+	Repos []string `yaml:"repos"`
+	// Path overrides the default path of the netrc, Maven settings.xml or
+	// npmrc file.
+	Path string `yaml:"path"`
+	// Merge only replaces the netrc or apt entries of the repos.
+	Merge bool `yaml:"merge"`
+	// RepoIDs overrides the Maven repo IDs.
+	RepoIDs []string `yaml:"repoIDs"`
+	// Scope is the npm scope of the repos.
+	Scope string `yaml:"scope"`
+	// ConfigName overrides the name of the apt auth config file.
+	ConfigName string `yaml:"configName"`
+
+	// keys are what the credential is set for, i.e. the hosts, repo IDs or
+	// repo URLs depending on the type.
+	keys []string
+}
+
+func (c *ApplyCommand) Desc() string {
+	return "Set the credential in multiple config files listed in a config file."
+}
+
+func (c *ApplyCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+Set the credential in every target listed in the config file, in YAML or JSON,
+like the set-* command of the target type does. The credential is fetched once
+for all targets, and refreshed for all of them in a single background refresh.
+
+  # Example config file.
+  targets:
+    - type: netrc
+      repos: [us-go.pkg.dev/my-project/repo1, us-python.pkg.dev/my-project/repo2]
+      merge: true
+    - type: maven
+      repos: [us-maven.pkg.dev/my-project/repo3]
+      repoIDs: [my-repo]
+    - type: npm
+      repos: [us-npm.pkg.dev/my-project/repo4]
+      scope: "@my-scope"
+    - type: apt
+      repos: [us-apt.pkg.dev/my-project/repo5]
+      configName: my-repo.conf
+
+  # Example: Apply the config file in the current dir
+  artifact-registry-cred-helper apply
+
+  # Example: Apply a config file and keep the credentials fresh
+  artifact-registry-cred-helper apply --config ~/ar-cred-helper.yaml --background-refresh-interval 5m
+`
+}
+
+func (c *ApplyCommand) Flags() *cli.FlagSet {
+	c.commonFlags = &CommonFlags{}
+	set := c.NewFlagSet()
+
+	sec := set.NewSection("APPLY OPTIONS")
+	sec.StringVar(&cli.StringVar{
+		Name:    "config",
+		Usage:   "The path to the config file listing the targets, in YAML or JSON.",
+		Target:  &c.configPath,
+		EnvVar:  "AR_CRED_HELPER_CONFIG",
+		Default: defaultApplyConfigPath,
+	})
+
+	c.commonFlags.addFlags(set.NewSection("COMMON OPTIONS"))
+
+	return set
+}
+
+func (c *ApplyCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	cfg, err := loadApplyConfig(c.configPath)
+	if err != nil {
+		return err
+	}
+	c.config = cfg
+
+	// The access boundary with --downscope covers the repos of all targets.
+	c.commonFlags.repoURLs = cfg.repoURLs()
+	if err := c.commonFlags.validateWithoutURLs(); err != nil {
+		return err
+	}
+
+	// Immediately run once.
+	expiry, err := c.runOnce(ctx, c.commonFlags.remove)
+	if err != nil {
+		return fmt.Errorf("failed to set credential: %w", err)
+	}
+
+	// Start background refresh if enabled.
+	return c.commonFlags.refresh(ctx, expiry, c.runOnce)
+}
+
+// runOnce gets the credential once and sets it in every target in turn, or
+// removes it with remove. A failed target doesn't stop the others.
+func (c *ApplyCommand) runOnce(ctx context.Context, remove bool) (time.Time, error) {
+	set, expiry, err := c.credential(ctx, c.commonFlags, remove)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var merr error
+	for i, t := range c.config.Targets {
+		open := func() (previewableConfig, error) {
+			return t.open(c.commonFlags.dryRun)
+		}
+		if err := c.update(c.commonFlags, open, func(cfg authConfig) error {
+			set(cfg, t.keys)
+			return nil
+		}); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("target %d (%s): %w", i, t.Type, err))
+		}
+	}
+	return expiry, merr
+}
+
+// open opens the file of the target, which locks it where supported unless
+// unlocked.
+func (t *applyTarget) open(unlocked bool) (previewableConfig, error) {
+	opts := openOptions{merge: t.Merge, scope: t.Scope, unlocked: unlocked}
+	switch t.Type {
+	case targetNetRC:
+		return openNetRC(t.Path, opts)
+	case targetMaven:
+		return openMaven(t.Path, opts)
+	case targetNPM:
+		return openNPM(t.Path, opts)
+	case targetApt:
+		return openApt(t.ConfigName, opts)
+	}
+	// No error is possible here because we have validated the config.
+	return nil, fmt.Errorf("unknown target type %q", t.Type)
+}
+
+// loadApplyConfig reads and validates the config file.
+func loadApplyConfig(path string) (*applyConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg applyConfig
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// validate validates the targets and works out their keys.
+func (cfg *applyConfig) validate() error {
+	if len(cfg.Targets) == 0 {
+		return fmt.Errorf("no targets specified")
+	}
+
+	var merr error
+	for i, t := range cfg.Targets {
+		if err := t.validate(); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("target %d: %w", i, err))
+		}
+	}
+	return merr
+}
+
+func (t *applyTarget) validate() error {
+	var merr error
+
+	switch t.Type {
+	case targetNetRC, targetMaven, targetNPM, targetApt:
+	default:
+		return fmt.Errorf("type must be one of %q, %q, %q or %q, got %q", targetNetRC, targetMaven, targetNPM, targetApt, t.Type)
+	}
+
+	if len(t.Repos) == 0 && !(t.Type == targetMaven && len(t.RepoIDs) > 0) {
+		merr = errors.Join(merr, fmt.Errorf("no repos specified"))
+	}
+	if t.Path != "" && t.Type == targetApt {
+		merr = errors.Join(merr, fmt.Errorf("path is not supported by apt, use configName"))
+	}
+	if t.Merge && t.Type != targetNetRC && t.Type != targetApt {
+		merr = errors.Join(merr, fmt.Errorf("merge is only supported by netrc and apt"))
+	}
+	if len(t.RepoIDs) > 0 && t.Type != targetMaven {
+		merr = errors.Join(merr, fmt.Errorf("repoIDs is only supported by maven"))
+	}
+	if t.Scope != "" && t.Type != targetNPM {
+		merr = errors.Join(merr, fmt.Errorf("scope is only supported by npm"))
+	}
+	if t.ConfigName != "" && t.Type != targetApt {
+		merr = errors.Join(merr, fmt.Errorf("configName is only supported by apt"))
+	}
+
+	t.keys = nil
+	for _, r := range t.Repos {
+		u, err := parseRepoURL(r)
+		if err != nil {
+			merr = errors.Join(merr, err)
+			continue
+		}
+
+		var key string
+		switch t.Type {
+		case targetNetRC, targetApt:
+			key = u.Host
+		case targetMaven:
+			key = maven.DefaultRepoID(u)
+		case targetNPM:
+			key = r
+		}
+		if !slices.Contains(t.keys, key) {
+			t.keys = append(t.keys, key)
+		}
+	}
+	if len(t.RepoIDs) > 0 {
+		t.keys = t.RepoIDs
+	}
+
+	return merr
+}
+
+// repoURLs returns the repos of all targets without duplicates.
+func (cfg *applyConfig) repoURLs() []string {
+	var repos []string
+	for _, t := range cfg.Targets {
+		for _, r := range t.Repos {
+			if !slices.Contains(repos, r) {
+				repos = append(repos, r)
+			}
+		}
+	}
+	return repos
+}
@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+func TestLoadApplyConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		content  string
+		wantKeys [][]string
+		wantErr  string
+	}{
+		{
+			name: "yaml",
+			content: `
+targets:
+  - type: netrc
+    repos: [us-go.pkg.dev/proj/repo1, us-go.pkg.dev/proj/repo2, us-python.pkg.dev/proj/repo3]
+    merge: true
+  - type: maven
+    repos: [us-maven.pkg.dev/proj/repo4]
+  - type: maven
+    repoIDs: [my-repo]
+  - type: npm
+    repos: [us-npm.pkg.dev/proj/repo5]
+    scope: "@my-scope"
+  - type: apt
+    repos: [us-apt.pkg.dev/proj/repo6]
+    configName: my-repo.conf
+`,
+			wantKeys: [][]string{
+				{"us-go.pkg.dev", "us-python.pkg.dev"},
+				{"artifactregistry-proj-repo4"},
+				{"my-repo"},
+				{"us-npm.pkg.dev/proj/repo5"},
+				{"us-apt.pkg.dev"},
+			},
+		},
+		{
+			name:     "json",
+			content:  `{"targets": [{"type": "netrc", "repos": ["us-go.pkg.dev/proj/repo1"]}]}`,
+			wantKeys: [][]string{{"us-go.pkg.dev"}},
+		},
+		{
+			name:    "empty",
+			content: "",
+			wantErr: "no targets specified",
+		},
+		{
+			name:    "unknown field",
+			content: "targets:\n  - type: netrc\n    repo: [us-go.pkg.dev/proj/repo1]\n",
+			wantErr: "field repo not found",
+		},
+		{
+			name:    "unknown type",
+			content: "targets:\n  - type: gradle\n    repos: [us-maven.pkg.dev/proj/repo1]\n",
+			wantErr: `target 0: type must be one of "netrc", "maven", "npm" or "apt", got "gradle"`,
+		},
+		{
+			name: "invalid targets",
+			content: `
+targets:
+  - type: netrc
+    scope: "@my-scope"
+  - type: npm
+    repos: [example.com/proj/repo1]
+    merge: true
+`,
+			wantErr: "target 0: no repos specified\n" +
+				"scope is only supported by npm\n" +
+				"target 1: merge is only supported by netrc and apt\n" +
+				"repo URL \"https://example.com/proj/repo1\" not in format",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(p, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := loadApplyConfig(p)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("loadApplyConfig() unexpected error: %s", diff)
+			}
+			if err != nil {
+				return
+			}
+
+			var gotKeys [][]string
+			for _, target := range cfg.Targets {
+				gotKeys = append(gotKeys, target.keys)
+			}
+			if diff := cmp.Diff(tc.wantKeys, gotKeys); diff != "" {
+				t.Errorf("loadApplyConfig() keys (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	netrcPath := filepath.Join(dir, ".netrc")
+	mavenPath := filepath.Join(dir, "settings.xml")
+	npmrcPath := filepath.Join(dir, ".npmrc")
+	configPath := filepath.Join(dir, "config.yaml")
+
+	if err := os.WriteFile(netrcPath, []byte("machine us-python.pkg.dev login oauth2accesstoken password other\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte(`
+targets:
+  - type: netrc
+    path: `+netrcPath+`
+    repos: [us-go.pkg.dev/proj/repo1]
+    merge: true
+  - type: maven
+    path: `+mavenPath+`
+    repos: [us-maven.pkg.dev/proj/repo2]
+  - type: npm
+    path: `+npmrcPath+`
+    repos: [us-npm.pkg.dev/proj/repo3]
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	newCommand := func() *ApplyCommand {
+		return &ApplyCommand{baseCommand: baseCommand{tokenProvider: auth.TokenProviderFunc(func(ctx context.Context) (*auth.Token, error) {
+			calls.Add(1)
+			return &auth.Token{Value: "test-token"}, nil
+		})}}
+	}
+
+	if err := newCommand().Run(context.Background(), []string{"--config", configPath}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Run() fetched %d tokens, want 1", got)
+	}
+
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		{path: netrcPath, want: []string{"machine us-python.pkg.dev", "machine us-go.pkg.dev\nlogin oauth2accesstoken\npassword test-token"}},
+		{path: mavenPath, want: []string{"<id>artifactregistry-proj-repo2</id>", "<password>test-token</password>"}},
+		{path: npmrcPath, want: []string{"registry=https://us-npm.pkg.dev/proj/repo3/", ":_authToken="}},
+	} {
+		b, err := os.ReadFile(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(string(b), want) {
+				t.Errorf("%s = %q, want it to contain %q", tc.path, b, want)
+			}
+		}
+	}
+
+	// Dry run of removing prints a diff per target and changes nothing.
+	before, err := os.ReadFile(netrcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	cmd := newCommand()
+	cmd.SetStdout(&stdout)
+	if err := cmd.Run(context.Background(), []string{"--config", configPath, "--remove", "--dry-run"}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, p := range []string{netrcPath, mavenPath, npmrcPath} {
+		if !strings.Contains(stdout.String(), "--- "+p+"\n") {
+			t.Errorf("Run() output = %q, want a diff of %s", stdout.String(), p)
+		}
+	}
+	after, err := os.ReadFile(netrcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(before), string(after)); diff != "" {
+		t.Errorf("file changed in dry run (-want,+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/daemon"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/refresh"
+)
+
+type DaemonCommand struct {
+	baseCommand
+
+	commonFlags     *CommonFlags
+	socketPath      string
+	refreshInterval time.Duration
+	refreshFraction float64
+}
+
+func (c *DaemonCommand) Desc() string {
+	return "Serve fresh access tokens to other commands over a Unix socket."
+}
+
+func (c *DaemonCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+Keep an access token in memory, refresh it before it expires, and serve it
+over a Unix domain socket that only the current user can access. The get,
+docker-credential and git-credential commands get the token from the daemon
+with --use-daemon, instead of fetching a token from Application Default
+Credentials or gcloud on every call, e.g. for every fetch of Bazel.
+
+The daemon runs until SIGINT or SIGTERM, or until it fails to refresh the
+token after retries. The socket is removed when it stops.
+
+  # Example: Start the daemon in the background
+  artifact-registry-cred-helper daemon &
+
+  # Example: Get tokens from the daemon for Go modules
+  export GOAUTH='artifact-registry-cred-helper get --use-daemon --format=goauth --hosts=us-go.pkg.dev'
+
+  # Example: Get tokens from the daemon for Docker
+  export AR_CRED_HELPER_USE_DAEMON=true
+`
+}
+
+func (c *DaemonCommand) Flags() *cli.FlagSet {
+	c.commonFlags = &CommonFlags{}
+	set := c.NewFlagSet()
+	sec := set.NewSection("OPTIONS")
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "socket",
+		Usage:   "The path of the Unix socket to serve the access token at. Default to a per-user path in $XDG_RUNTIME_DIR or the temp dir.",
+		Target:  &c.socketPath,
+		EnvVar:  "AR_CRED_HELPER_DAEMON_SOCKET",
+		Example: "/run/user/1000/artifact-registry-cred-helper/daemon.sock",
+	})
+
+	sec.DurationVar(&cli.DurationVar{
+		Name:    "refresh-interval",
+		Usage:   "The interval to refresh the access token when its expiry is unknown, e.g. with --access-token-from-env.",
+		Target:  &c.refreshInterval,
+		Default: 5 * time.Minute,
+		EnvVar:  "AR_CRED_HELPER_DAEMON_REFRESH_INTERVAL",
+		Example: "5m",
+	})
+
+	sec.Float64Var(&cli.Float64Var{
+		Name:    "refresh-fraction",
+		Usage:   "The fraction of the remaining lifetime of the access token to wait before refreshing it. Failed refreshes are retried with exponential backoff.",
+		Target:  &c.refreshFraction,
+		Default: refresh.DefaultFraction,
+		EnvVar:  "AR_CRED_HELPER_DAEMON_REFRESH_FRACTION",
+		Example: "0.5",
+	})
+
+	c.commonFlags.addTokenFlags(sec)
+
+	return set
+}
+
+func (c *DaemonCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if err := refresh.ValidateInterval(c.refreshInterval); err != nil {
+		return fmt.Errorf("invalid --refresh-interval: %w", err)
+	}
+	if err := refresh.ValidateFraction(c.refreshFraction); err != nil {
+		return fmt.Errorf("invalid --refresh-fraction: %w", err)
+	}
+	if err := c.commonFlags.validateWithoutURLs(); err != nil {
+		return err
+	}
+	if c.socketPath == "" {
+		c.socketPath = daemon.DefaultSocketPath()
+	}
+
+	// Fail fast if there is no credential to serve.
+	opts, err := c.commonFlags.tokenOptions()
+	if err != nil {
+		return err
+	}
+	token, err := c.token(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	ln, err := daemon.Listen(c.socketPath)
+	if err != nil {
+		return err //nolint:wrapcheck // Already descriptive
+	}
+
+	srv := &daemon.Server{}
+	srv.SetToken(token)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() {
+		// Serve closes the listener, which removes the socket. Stop refreshing
+		// if it fails.
+		served <- srv.Serve(ctx, ln)
+		cancel()
+	}()
+	fmt.Fprintf(c.Stderr(), "Serving access tokens at %s\n", c.socketPath)
+
+	s := &refresh.Scheduler{
+		Interval: c.refreshInterval,
+		Fraction: c.refreshFraction,
+	}
+	refreshErr := s.Run(ctx, token.Expiry, func(ctx context.Context) (time.Time, error) {
+		token, err := c.token(ctx, opts)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to refresh access token: %w", err)
+		}
+		srv.SetToken(token)
+		return token.Expiry, nil
+	})
+	// Stopping on a signal is not an error.
+	if errors.Is(refreshErr, context.Canceled) {
+		refreshErr = nil
+	}
+
+	cancel()
+	return errors.Join(refreshErr, <-served)
+}
+
+// daemonClientFlags are the flags to get access tokens from a daemon instead.
+type daemonClientFlags struct {
+	useDaemon    bool
+	daemonSocket string
+}
+
+func (f *daemonClientFlags) addFlags(sec *cli.FlagSection) {
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "use-daemon",
+		Usage:  "Get the access token from a running daemon instead, see the daemon command.",
+		Target: &f.useDaemon,
+		EnvVar: "AR_CRED_HELPER_USE_DAEMON",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "daemon-socket",
+		Usage:   "The path of the Unix socket of the daemon used with --use-daemon. Default to a per-user path in $XDG_RUNTIME_DIR or the temp dir.",
+		Target:  &f.daemonSocket,
+		EnvVar:  "AR_CRED_HELPER_DAEMON_SOCKET",
+		Example: "/run/user/1000/artifact-registry-cred-helper/daemon.sock",
+	})
+}
+
+// tokenOptions returns where access tokens come from per the flags.
+func (f *daemonClientFlags) tokenOptions() tokenOptions {
+	if !f.useDaemon {
+		return tokenOptions{}
+	}
+	socket := f.daemonSocket
+	if socket == "" {
+		socket = daemon.DefaultSocketPath()
+	}
+	return tokenOptions{daemonSocket: socket}
+}
@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/daemon"
+)
+
+func TestDaemonCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir().
+	dir, err := os.MkdirTemp("", "arch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "d.sock")
+
+	var calls atomic.Int32
+	cmd := &DaemonCommand{baseCommand: baseCommand{tokenProvider: auth.TokenProviderFunc(func(ctx context.Context) (*auth.Token, error) {
+		calls.Add(1)
+		return &auth.Token{Value: "test-token", Expiry: time.Now().Add(time.Hour)}, nil
+	})}}
+	cmd.SetStderr(&bytes.Buffer{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cmd.Run(ctx, []string{"--socket", socket}) }()
+
+	// Wait for the daemon to serve.
+	client := &daemon.Client{SocketPath: socket}
+	for i := 0; ; i++ {
+		if _, err := client.Token(context.Background()); err == nil {
+			break
+		}
+		if i >= 100 {
+			t.Fatal("daemon didn't start serving")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	tests := []struct {
+		name  string
+		cmd   cli.Command
+		args  []string
+		stdin string
+		want  string
+	}{
+		{
+			name: "get",
+			cmd:  &GetCommand{},
+			args: []string{"--use-daemon", "--daemon-socket", socket, "--format", "goauth", "--hosts", "us-go.pkg.dev"},
+			want: "Authorization: Bearer test-token",
+		},
+		{
+			name:  "docker-credential",
+			cmd:   &DockerCredentialCommand{},
+			args:  []string{"--use-daemon", "--daemon-socket", socket, "get"},
+			stdin: "us-docker.pkg.dev",
+			want:  `"Secret":"test-token"`,
+		},
+		{
+			name:  "git-credential",
+			cmd:   &GitCredentialCommand{},
+			args:  []string{"--use-daemon", "--daemon-socket", socket, "get"},
+			stdin: "protocol=https\nhost=us-go.pkg.dev\n\n",
+			want:  "password=test-token",
+		},
+	}
+	for _, tc := range tests {
+		var stdout bytes.Buffer
+		tc.cmd.SetStdin(strings.NewReader(tc.stdin))
+		tc.cmd.SetStdout(&stdout)
+		if err := tc.cmd.Run(context.Background(), tc.args); err != nil {
+			t.Fatalf("%s: Run() error = %v", tc.name, err)
+		}
+		if !strings.Contains(stdout.String(), tc.want) {
+			t.Errorf("%s: Run() output = %q, want it to contain %q", tc.name, stdout.String(), tc.want)
+		}
+	}
+
+	// The token is fetched once and then served from memory.
+	if got := calls.Load(); got != 1 {
+		t.Errorf("daemon fetched %d tokens, want 1", got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() didn't return after the context was cancelled")
+	}
+	if _, err := os.Lstat(socket); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket not removed after the daemon stopped: %v", err)
+	}
+}
+
+func TestDaemonCommand_Run_tokenError(t *testing.T) {
+	t.Parallel()
+
+	cmd := &DaemonCommand{baseCommand: baseCommand{tokenProvider: auth.TokenProviderFunc(func(ctx context.Context) (*auth.Token, error) {
+		return nil, errors.New("no credential")
+	})}}
+	err := cmd.Run(context.Background(), []string{"--socket", filepath.Join(t.TempDir(), "d.sock")})
+	if diff := testutil.DiffErrString(err, "failed to get access token: no credential"); diff != "" {
+		t.Errorf("Run() unexpected error: %s", diff)
+	}
+}
+
+func TestDaemonCommand_Run_invalidFlags(t *testing.T) {
+	t.Parallel()
+
+	cmd := &DaemonCommand{}
+	err := cmd.Run(context.Background(), []string{"--credential-config", "wif.json", "--access-token-from-env", "TOKEN"})
+	if diff := testutil.DiffErrString(err, "--credential-config cannot be used with"); diff != "" {
+		t.Errorf("Run() unexpected error: %s", diff)
+	}
+}
+
+func TestGetCommand_Run_useDaemonConflicts(t *testing.T) {
+	t.Parallel()
+
+	cmd := &GetCommand{}
+	err := cmd.Run(context.Background(), []string{"--use-daemon", "--access-token-from-env", "TOKEN", "--hosts", "us-go.pkg.dev"})
+	if diff := testutil.DiffErrString(err, "--use-daemon cannot be used with"); diff != "" {
+		t.Errorf("Run() unexpected error: %s", diff)
+	}
+}
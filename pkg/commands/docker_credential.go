@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/abcxyz/pkg/cli"
+)
+
+// errDockerCredentialsNotFound is the message Docker expects when a helper
+// doesn't have credentials for a server, see
+// https://github.com/docker/docker-credential-helpers/blob/master/credentials/error.go
+var errDockerCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// dockerCredential is the payload of the Docker credential helper protocol.
+type dockerCredential struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+type DockerCredentialCommand struct {
+	baseCommand
+
+	daemonFlags daemonClientFlags
+}
+
+func (c *DockerCredentialCommand) Desc() string {
+	return "Act as a Docker credential helper for Artifact Registry."
+}
+
+func (c *DockerCredentialCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [get|store|erase|list]
+
+Implement the Docker credential helper protocol for '*-docker.pkg.dev' hosts.
+See: https://github.com/docker/docker-credential-helpers.
+
+The same behavior applies when the binary is invoked as
+'docker-credential-artifact-registry', e.g. via a symlink:
+
+  ln -s $(which artifact-registry-cred-helper) /usr/local/bin/docker-credential-artifact-registry
+
+And then in ~/.docker/config.json:
+
+  {
+    "credHelpers": {
+      "us-docker.pkg.dev": "artifact-registry"
+    }
+  }
+
+Credentials are always derived from the environment, so 'store' and 'erase' are
+no-ops. With --use-daemon, or AR_CRED_HELPER_USE_DAEMON=true, the access token
+is from a running daemon instead, see the daemon command.
+`
+}
+
+func (c *DockerCredentialCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.daemonFlags.addFlags(set.NewSection("OPTIONS"))
+	return set
+}
+
+func (c *DockerCredentialCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if len(f.Args()) != 1 {
+		return fmt.Errorf("expected exactly one operation of get, store, erase or list, got %q", f.Args())
+	}
+
+	switch op := f.Arg(0); op {
+	case "get":
+		if err := c.get(ctx); err != nil {
+			// Like credentials.Serve, reply with the error on stdout, which is all
+			// Docker reads, e.g. to tell missing credentials from a failure.
+			fmt.Fprintln(c.Stdout(), err)
+			return err
+		}
+		return nil
+	case "store", "erase":
+		// Drain the input so the caller doesn't see a broken pipe.
+		if _, err := io.Copy(io.Discard, c.Stdin()); err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		return nil
+	case "list":
+		if _, err := c.Stdout().Write([]byte("{}")); err != nil {
+			return fmt.Errorf("failed to write response: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q", op)
+	}
+}
+
+func (c *DockerCredentialCommand) get(ctx context.Context) error {
+	b, err := io.ReadAll(c.Stdin())
+	if err != nil {
+		return fmt.Errorf("failed to read stdin: %w", err)
+	}
+	serverURL := strings.TrimSpace(string(b))
+
+	host, err := dockerHost(serverURL)
+	if err != nil {
+		return err
+	}
+	if err := validateHosts([]string{host}); err != nil || !strings.HasSuffix(host, "-docker.pkg.dev") {
+		return errDockerCredentialsNotFound
+	}
+
+	token, err := c.token(ctx, c.daemonFlags.tokenOptions())
+	if err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(&dockerCredential{
+		ServerURL: serverURL,
+		Username:  "oauth2accesstoken",
+		Secret:    token.Value,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+
+	if _, err := c.Stdout().Write(out); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return nil
+}
+
+// dockerHost extracts the host from a Docker server URL, which may or may not
+// have a scheme, e.g. "us-docker.pkg.dev" or "https://us-docker.pkg.dev/v2/".
+func dockerHost(serverURL string) (string, error) {
+	if serverURL == "" {
+		return "", errors.New("no server URL specified")
+	}
+	if !strings.Contains(serverURL, "://") {
+		serverURL = "https://" + serverURL
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse server URL %q: %w", serverURL, err)
+	}
+	return u.Hostname(), nil
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+func TestDockerCredentialCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		args          []string
+		stdin         string
+		tokenProvider auth.TokenProvider
+		expectedErr   string
+		expectedOut   string
+	}{
+		{
+			name:          "get with host",
+			args:          []string{"get"},
+			stdin:         "us-docker.pkg.dev\n",
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedOut:   `{"ServerURL":"us-docker.pkg.dev","Username":"oauth2accesstoken","Secret":"test-token"}`,
+		},
+		{
+			name:          "get with URL",
+			args:          []string{"get"},
+			stdin:         "https://europe-west1-docker.pkg.dev/v2/",
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedOut:   `{"ServerURL":"https://europe-west1-docker.pkg.dev/v2/","Username":"oauth2accesstoken","Secret":"test-token"}`,
+		},
+		{
+			name:          "get non docker host",
+			args:          []string{"get"},
+			stdin:         "us-go.pkg.dev",
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedErr:   "credentials not found in native keychain",
+			expectedOut:   "credentials not found in native keychain\n",
+		},
+		{
+			name:          "get other registry",
+			args:          []string{"get"},
+			stdin:         "https://index.docker.io/v1/",
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedErr:   "credentials not found in native keychain",
+			expectedOut:   "credentials not found in native keychain\n",
+		},
+		{
+			name:        "get empty input",
+			args:        []string{"get"},
+			expectedErr: "no server URL specified",
+			expectedOut: "no server URL specified\n",
+		},
+		{
+			name:  "token provider error",
+			args:  []string{"get"},
+			stdin: "us-docker.pkg.dev",
+			tokenProvider: auth.TokenProviderFunc(func(context.Context) (*auth.Token, error) {
+				return nil, fmt.Errorf("token error")
+			}),
+			expectedErr: "failed to get access token: token error",
+			expectedOut: "failed to get access token: token error\n",
+		},
+		{
+			name:  "store is no-op",
+			args:  []string{"store"},
+			stdin: `{"ServerURL":"us-docker.pkg.dev","Username":"u","Secret":"s"}`,
+		},
+		{
+			name:  "erase is no-op",
+			args:  []string{"erase"},
+			stdin: "us-docker.pkg.dev",
+		},
+		{
+			name:        "list",
+			args:        []string{"list"},
+			expectedOut: "{}",
+		},
+		{
+			name:        "unknown operation",
+			args:        []string{"remove"},
+			expectedErr: `unknown operation "remove"`,
+		},
+		{
+			name:        "no operation",
+			expectedErr: "expected exactly one operation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := &DockerCredentialCommand{
+				baseCommand: baseCommand{
+					tokenProvider: tt.tokenProvider,
+				},
+			}
+
+			var stdin bytes.Buffer
+			stdin.WriteString(tt.stdin)
+			cmd.SetStdin(&stdin)
+
+			var stdout bytes.Buffer
+			cmd.SetStdout(&stdout)
+
+			err := cmd.Run(context.Background(), tt.args)
+			if diff := testutil.DiffErrString(err, tt.expectedErr); diff != "" {
+				t.Errorf("unexpected error: %s", diff)
+				return
+			}
+
+			if got := stdout.String(); got != tt.expectedOut {
+				t.Errorf("expected output %q, got %q", tt.expectedOut, got)
+			}
+		})
+	}
+}
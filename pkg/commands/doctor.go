@@ -0,0 +1,326 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/abcxyz/pkg/cli"
+)
+
+type DoctorCommand struct {
+	baseCommand
+
+	commonFlags *CommonFlags
+	endpoint    string
+	packages    []string
+
+	// endpointURL is the parsed endpoint, if set.
+	endpointURL *url.URL
+
+	// client is the HTTP client to probe repos. Default to http.DefaultClient.
+	client *http.Client
+}
+
+// probeResult is the result of probing a repo.
+type probeResult struct {
+	repo   string
+	format string
+	url    string
+	result string
+	hint   string
+	failed bool
+}
+
+func (c *DoctorCommand) Desc() string {
+	return "Check the credential against the given repos end to end."
+}
+
+func (c *DoctorCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+For each repo, send an authenticated request appropriate to the repo format
+with the same credential the set-* commands would write, and report whether it
+fails for authentication, permission or a missing repo or package, with hints
+to fix it. The request is:
+
+  maven   The maven-metadata.xml of the package, or the repo root.
+  python  The PyPI simple index of the package, or of the repo.
+  npm     The package document, or the repo root.
+  go      The version list of the module, or the repo root.
+  apt     The Release file of the repo.
+
+Without a package for the format, a 404 still means the credential is good.
+
+  # Example: Check a Maven and a Python repo
+  artifact-registry-cred-helper doctor --repo-urls us-maven.pkg.dev/my-project/repo1,us-python.pkg.dev/my-project/repo2
+
+  # Example: Check a specific npm package
+  artifact-registry-cred-helper doctor --repo-urls us-npm.pkg.dev/my-project/repo1 --package npm=@my-scope/my-package
+`
+}
+
+func (c *DoctorCommand) Flags() *cli.FlagSet {
+	c.commonFlags = &CommonFlags{}
+	set := c.NewFlagSet()
+	sec := set.NewSection("OPTIONS")
+
+	sec.StringSliceVar(&cli.StringSliceVar{
+		Name:    "repo-urls",
+		Usage:   "REQUIRED. The repos to check. Must in format '*.pkg.dev/[project]/[repo]'.",
+		Target:  &c.commonFlags.repoURLs,
+		EnvVar:  "AR_CRED_HELPER_HOSTS",
+		Example: "us-go.pkg.dev/my-project/repo1,asia-maven.pkg.dev/my-project/repo2",
+	})
+
+	sec.StringSliceVar(&cli.StringSliceVar{
+		Name:    "package",
+		Usage:   "The package to probe for a repo format, in format '[format]=[package]'. Maven packages are in format '[groupId]:[artifactId]'.",
+		Target:  &c.packages,
+		EnvVar:  "AR_CRED_HELPER_DOCTOR_PACKAGES",
+		Example: "maven=com.example:my-lib,go=example.com/my/module",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "endpoint",
+		Usage:   "Override the scheme and host of the requests, e.g. to check against a local fake registry.",
+		Target:  &c.endpoint,
+		EnvVar:  "AR_CRED_HELPER_DOCTOR_ENDPOINT",
+		Example: "http://localhost:8080",
+	})
+
+	c.commonFlags.addAuthFlags(sec)
+
+	return set
+}
+
+func (c *DoctorCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if err := c.commonFlags.validate(); err != nil {
+		return err
+	}
+
+	packages := make(map[string]string, len(c.packages))
+	for _, p := range c.packages {
+		format, pkg, ok := strings.Cut(p, "=")
+		if !ok || format == "" || pkg == "" {
+			return fmt.Errorf("package %q not in format '[format]=[package]'", p)
+		}
+		packages[format] = pkg
+	}
+
+	if c.endpoint != "" {
+		e, err := url.Parse(c.endpoint)
+		if err != nil || e.Scheme == "" || e.Host == "" {
+			return fmt.Errorf("endpoint %q not in format '[scheme]://[host]'", c.endpoint)
+		}
+		c.endpointURL = e
+	}
+
+	user, pwd, err := c.credential(ctx)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	w := tabwriter.NewWriter(c.Stdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tFORMAT\tURL\tRESULT\tHINT")
+	for _, u := range c.commonFlags.parsedURLs {
+		r := c.probe(ctx, u, packages, user, pwd)
+		if r.failed {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.repo, orDash(r.format), orDash(r.url), r.result, orDash(r.hint))
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d repos failed the check", failed, len(c.commonFlags.parsedURLs))
+	}
+	return nil
+}
+
+// credential returns the username and password the set-* commands would
+// write.
+func (c *DoctorCommand) credential(ctx context.Context) (string, string, error) {
+	if c.commonFlags.jsonKeyPath != "" {
+		k, err := c.getEncodedJSONKey(c.commonFlags.jsonKeyPath)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encode JSON key: %w", err)
+		}
+		return "_json_key_base64", k, nil
+	}
+
+	opts, err := c.commonFlags.tokenOptions()
+	if err != nil {
+		return "", "", err
+	}
+	token, err := c.token(ctx, opts)
+	if err != nil {
+		return "", "", err
+	}
+	return "oauth2accesstoken", token.Value, nil
+}
+
+// probe sends an authenticated request to the repo and classifies the result.
+func (c *DoctorCommand) probe(ctx context.Context, repo *url.URL, packages map[string]string, user, pwd string) *probeResult {
+	r := &probeResult{repo: repo.Host + strings.TrimSuffix(repo.Path, "/"), failed: true}
+
+	format, err := repoFormat(repo.Host)
+	if err != nil {
+		r.result = err.Error()
+		return r
+	}
+	r.format = format
+
+	u, err := probeURL(repo, format, packages[format])
+	if err != nil {
+		r.result = err.Error()
+		return r
+	}
+	if c.endpointURL != nil {
+		u.Scheme, u.Host = c.endpointURL.Scheme, c.endpointURL.Host
+	}
+	r.url = u.String()
+
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		r.result = fmt.Sprintf("failed to create request: %v", err)
+		return r
+	}
+	req.SetBasicAuth(user, pwd)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		r.result = fmt.Sprintf("request failed: %v", err)
+		r.hint = "Check the network connection and proxy settings."
+		return r
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	r.result = resp.Status
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		r.failed = false
+	case resp.StatusCode == http.StatusUnauthorized:
+		r.hint = "The credential is missing, invalid or expired. Check the credential source, e.g. 'gcloud auth application-default login'."
+	case resp.StatusCode == http.StatusForbidden:
+		r.hint = "The principal lacks permission. Grant it roles/artifactregistry.reader on the repo, and check the project and repo name."
+	case resp.StatusCode == http.StatusNotFound:
+		if packages[format] == "" && format != "python" && format != "apt" {
+			// There is no package to probe, so not found only tells the
+			// credential has passed authentication and authorization.
+			r.failed = false
+			r.result += " (authorized)"
+			r.hint = fmt.Sprintf("Pass --package %s=[package] to probe a specific package.", format)
+			break
+		}
+		r.hint = "The repo or package doesn't exist. Check the repo URL and package name."
+	default:
+		r.hint = "Unexpected response from the registry."
+	}
+	return r
+}
+
+// repoFormat returns the format of a repo host in format
+// '[location]-[format].pkg.dev', e.g. 'go' for 'us-go.pkg.dev'.
+func repoFormat(host string) (string, error) {
+	if _, err := repoLocation(host); err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(host, ".pkg.dev")
+	return name[strings.LastIndex(name, "-")+1:], nil
+}
+
+// probeURL returns the URL to probe the repo of the format, with the package
+// if not empty.
+func probeURL(repo *url.URL, format, pkg string) (*url.URL, error) {
+	project, name, _ := strings.Cut(strings.Trim(repo.Path, "/"), "/")
+	base := "https://" + repo.Host + "/" + project + "/" + name + "/"
+
+	var raw string
+	switch format {
+	case "maven":
+		raw = base
+		if pkg != "" {
+			group, artifact, ok := strings.Cut(pkg, ":")
+			if !ok {
+				return nil, fmt.Errorf("maven package %q not in format '[groupId]:[artifactId]'", pkg)
+			}
+			raw += strings.ReplaceAll(group, ".", "/") + "/" + artifact + "/maven-metadata.xml"
+		}
+	case "python":
+		raw = base + "simple/"
+		if pkg != "" {
+			raw += normalizePythonName(pkg) + "/"
+		}
+	case "npm":
+		raw = base
+		if pkg != "" {
+			raw += strings.ReplaceAll(pkg, "/", "%2f")
+		}
+	case "go":
+		raw = base
+		if pkg != "" {
+			raw += escapeModulePath(pkg) + "/@v/list"
+		}
+	case "apt":
+		raw = "https://" + repo.Host + "/projects/" + project + "/dists/" + name + "/Release"
+	default:
+		return nil, fmt.Errorf("unsupported repo format %q", format)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse probe URL %q: %w", raw, err)
+	}
+	return u, nil
+}
+
+// normalizePythonName normalizes a Python package name per PEP 503.
+func normalizePythonName(name string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(name) {
+		if r == '-' || r == '_' || r == '.' {
+			sep = true
+			continue
+		}
+		if sep && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		sep = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeModulePath escapes upper case letters of a Go module path as '!' and
+// the lower case letter, like the module proxy protocol.
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+func TestDoctorCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	// The fake registry allows "test-token" to read proj/repo, and knows the
+	// packages below.
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pwd, ok := r.BasicAuth()
+		if !ok || user != "oauth2accesstoken" || pwd == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if pwd != "test-token" || strings.Contains(r.URL.Path, "/other-proj/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/proj/repo/com/example/my-lib/maven-metadata.xml",
+			"/proj/repo/simple/",
+			"/proj/repo/simple/my-package/",
+			"/proj/repo/@my-scope%2fmy-package",
+			"/proj/repo/example.com/!my/module/@v/list",
+			"/projects/proj/dists/repo/Release":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(registry.Close)
+	_, stsEndpoint := fakeCredentialConfig(t)
+
+	tests := []struct {
+		name          string
+		args          []string
+		tokenProvider auth.TokenProvider
+		endpoint      string
+		wantOut       []string
+		wantErr       string
+	}{
+		{
+			name: "all formats success",
+			args: []string{
+				"--repo-urls", "us-maven.pkg.dev/proj/repo,us-python.pkg.dev/proj/repo,us-npm.pkg.dev/proj/repo,us-go.pkg.dev/proj/repo,us-apt.pkg.dev/proj/repo",
+				"--package", "maven=com.example:my-lib,python=My_Package,npm=@my-scope/my-package,go=example.com/My/module",
+			},
+			tokenProvider: auth.Static{Value: "test-token"},
+			wantOut: []string{
+				"/proj/repo/com/example/my-lib/maven-metadata.xml",
+				"/proj/repo/simple/my-package/",
+				"/proj/repo/@my-scope%2fmy-package",
+				"/proj/repo/example.com/!my/module/@v/list",
+				"/projects/proj/dists/repo/Release",
+			},
+		},
+		{
+			name:          "not found without package is authorized",
+			args:          []string{"--repo-urls", "us-go.pkg.dev/proj/repo"},
+			tokenProvider: auth.Static{Value: "test-token"},
+			wantOut:       []string{"404 Not Found (authorized)", "Pass --package go=[package]"},
+		},
+		{
+			name: "not found package",
+			args: []string{
+				"--repo-urls", "us-python.pkg.dev/proj/repo",
+				"--package", "python=missing",
+			},
+			tokenProvider: auth.Static{Value: "test-token"},
+			wantOut:       []string{"404 Not Found", "The repo or package doesn't exist"},
+			wantErr:       "1 of 1 repos failed the check",
+		},
+		{
+			name:          "unauthenticated",
+			args:          []string{"--repo-urls", "us-python.pkg.dev/proj/repo"},
+			tokenProvider: auth.Static{Value: ""},
+			wantOut:       []string{"401 Unauthorized", "missing, invalid or expired"},
+			wantErr:       "1 of 1 repos failed the check",
+		},
+		{
+			name:          "permission denied",
+			args:          []string{"--repo-urls", "us-python.pkg.dev/proj/repo,us-python.pkg.dev/other-proj/repo"},
+			tokenProvider: auth.Static{Value: "test-token"},
+			wantOut:       []string{"200 OK", "403 Forbidden", "roles/artifactregistry.reader"},
+			wantErr:       "1 of 2 repos failed the check",
+		},
+		{
+			name:          "downscope",
+			args:          []string{"--repo-urls", "us-west1-python.pkg.dev/proj/repo", "--downscope", "--downscope-sts-endpoint", stsEndpoint},
+			tokenProvider: auth.Static{Value: "test-token"},
+			wantOut:       []string{"403 Forbidden"},
+			wantErr:       "1 of 1 repos failed the check",
+		},
+		{
+			name:          "unsupported format",
+			args:          []string{"--repo-urls", "us-docker.pkg.dev/proj/repo"},
+			tokenProvider: auth.Static{Value: "test-token"},
+			wantOut:       []string{`unsupported repo format "docker"`},
+			wantErr:       "1 of 1 repos failed the check",
+		},
+		{
+			name:          "invalid package",
+			args:          []string{"--repo-urls", "us-python.pkg.dev/proj/repo", "--package", "python"},
+			tokenProvider: auth.Static{Value: "test-token"},
+			wantErr:       `package "python" not in format '[format]=[package]'`,
+		},
+		{
+			name:    "no repo",
+			wantErr: "no host specified",
+		},
+		{
+			name:     "endpoint without scheme",
+			args:     []string{"--repo-urls", "us-west1-python.pkg.dev/proj/repo"},
+			endpoint: "localhost:8080",
+			wantErr:  `endpoint "localhost:8080" not in format '[scheme]://[host]'`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := &DoctorCommand{baseCommand: baseCommand{tokenProvider: tc.tokenProvider}}
+			var stdout bytes.Buffer
+			cmd.SetStdout(&stdout)
+
+			endpoint := registry.URL
+			if tc.endpoint != "" {
+				endpoint = tc.endpoint
+			}
+			err := cmd.Run(context.Background(), append(tc.args, "--endpoint", endpoint))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("Run() unexpected error: %s", diff)
+			}
+			for _, want := range tc.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Run() output doesn't contain %q:\n%s", want, stdout.String())
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
@@ -9,16 +10,30 @@ import (
 	"time"
 
 	"github.com/abcxyz/pkg/cli"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/refresh"
 )
 
 type CommonFlags struct {
 	repoURLs                  []string
 	accessTokenFromEnv        string
 	jsonKeyPath               string
+	credentialConfig          string
+	stsEndpoint               string
+	impersonateServiceAccount []string
+	iamCredentialsEndpoint    string
+	downscope                 bool
+	downscopeRole             string
+	downscopeSTSEndpoint      string
 	backgroundRefreshInterval time.Duration
 	backgroundRefreshDuration time.Duration
+	backgroundRefreshFraction float64
+	remove                    bool
+	cleanupOnExit             bool
+	dryRun                    bool
 
 	parsedURLs []*url.URL
+	parseErr   error
 	once       sync.Once
 }
 
@@ -29,11 +44,14 @@ func (f *CommonFlags) validate() error {
 		merr = errors.Join(merr, err)
 	}
 
-	if len(f.repoURLs) <= 0 {
+	// Without repo URLs, all Artifact Registry credentials are removed.
+	if len(f.repoURLs) <= 0 && !f.remove {
 		merr = errors.Join(merr, fmt.Errorf("no host specified"))
 	}
 
-	if err := f.parseURLs(); err != nil {
+	// With --downscope, validateWithoutURLs already reports them along with
+	// the access boundary.
+	if err := f.parseURLs(); err != nil && !f.downscope {
 		merr = errors.Join(merr, err)
 	}
 
@@ -43,17 +61,177 @@ func (f *CommonFlags) validate() error {
 func (f *CommonFlags) validateWithoutURLs() error {
 	var merr error
 
-	if f.backgroundRefreshInterval < 2*time.Minute && f.backgroundRefreshInterval > 0 {
-		merr = errors.Join(merr, fmt.Errorf("background refresh interval must be at least 2 minutes"))
+	if f.backgroundRefreshInterval > 0 {
+		if err := refresh.ValidateInterval(f.backgroundRefreshInterval); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("invalid --background-refresh-interval: %w", err))
+		}
+	}
+
+	if err := refresh.ValidateFraction(f.backgroundRefreshFraction); err != nil {
+		merr = errors.Join(merr, fmt.Errorf("invalid --background-refresh-fraction: %w", err))
+	}
+
+	if f.remove && f.backgroundRefreshInterval > 0 {
+		merr = errors.Join(merr, fmt.Errorf("--remove cannot be used with --background-refresh-interval"))
+	}
+
+	if f.cleanupOnExit && f.backgroundRefreshInterval <= 0 {
+		merr = errors.Join(merr, fmt.Errorf("--cleanup-on-exit requires --background-refresh-interval"))
+	}
+
+	if f.dryRun && f.backgroundRefreshInterval > 0 {
+		merr = errors.Join(merr, fmt.Errorf("--dry-run cannot be used with --background-refresh-interval"))
 	}
 
 	if f.jsonKeyPath != "" && f.accessTokenFromEnv != "" {
 		merr = errors.Join(merr, fmt.Errorf("only one of --json-key or --access-token-from-env can be set"))
 	}
 
+	if f.credentialConfig != "" && (f.jsonKeyPath != "" || f.accessTokenFromEnv != "") {
+		merr = errors.Join(merr, fmt.Errorf("--credential-config cannot be used with --json-key or --access-token-from-env"))
+	}
+
+	if len(f.impersonateServiceAccount) > 0 && f.jsonKeyPath != "" {
+		merr = errors.Join(merr, fmt.Errorf("--impersonate-service-account cannot be used with --json-key"))
+	}
+
+	if f.downscope {
+		if f.jsonKeyPath != "" {
+			merr = errors.Join(merr, fmt.Errorf("--downscope cannot be used with --json-key"))
+		}
+		_, ok := downscopeRoles[f.downscopeRole]
+		if !ok {
+			merr = errors.Join(merr, fmt.Errorf("downscope role must be one of %q or %q, got %q", "reader", "writer", f.downscopeRole))
+		}
+		// Without a valid access boundary, the token wouldn't be downscoped.
+		if len(f.repoURLs) == 0 {
+			merr = errors.Join(merr, fmt.Errorf("--downscope requires --repo-urls"))
+		} else if ok {
+			if _, err := f.accessBoundary(); err != nil {
+				merr = errors.Join(merr, err)
+			}
+		}
+	}
+
 	return merr
 }
 
+// tokenOptions returns where access tokens come from per the flags. With
+// --downscope, it fails if there is no valid access boundary rather than fall
+// back to a token that isn't downscoped.
+func (f *CommonFlags) tokenOptions() (tokenOptions, error) {
+	var boundary []auth.AccessBoundaryRule
+	if f.downscope {
+		var err error
+		if boundary, err = f.accessBoundary(); err != nil {
+			return tokenOptions{}, fmt.Errorf("failed to build access boundary: %w", err)
+		}
+		if len(boundary) == 0 {
+			return tokenOptions{}, fmt.Errorf("--downscope requires --repo-urls")
+		}
+	}
+	return tokenOptions{
+		accessTokenFromEnv: f.accessTokenFromEnv,
+		credentialConfig:   f.credentialConfig,
+		stsEndpoint:        f.stsEndpoint,
+
+		impersonateServiceAccount: f.impersonateServiceAccount,
+		iamCredentialsEndpoint:    f.iamCredentialsEndpoint,
+
+		accessBoundary:       boundary,
+		downscopeSTSEndpoint: f.downscopeSTSEndpoint,
+	}, nil
+}
+
+// downscopeRoles maps --downscope-role to the Artifact Registry role.
+var downscopeRoles = map[string]string{
+	"reader": "roles/artifactregistry.reader",
+	"writer": "roles/artifactregistry.writer",
+}
+
+// accessBoundary returns a Credential Access Boundary limited to the downscope
+// role on exactly the repos.
+func (f *CommonFlags) accessBoundary() ([]auth.AccessBoundaryRule, error) {
+	if err := f.parseURLs(); err != nil {
+		return nil, err
+	}
+
+	role, ok := downscopeRoles[f.downscopeRole]
+	if !ok {
+		return nil, fmt.Errorf("unknown downscope role %q", f.downscopeRole)
+	}
+
+	var merr error
+	rules := make([]auth.AccessBoundaryRule, 0, len(f.parsedURLs))
+	for _, u := range f.parsedURLs {
+		location, err := repoLocation(u.Host)
+		if err != nil {
+			merr = errors.Join(merr, err)
+			continue
+		}
+		project, repo, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+		rules = append(rules, auth.AccessBoundaryRule{
+			AvailableResource:    fmt.Sprintf("//artifactregistry.googleapis.com/projects/%s/locations/%s/repositories/%s", project, location, repo),
+			AvailablePermissions: []string{"inRole:" + role},
+		})
+	}
+	if merr != nil {
+		return nil, merr
+	}
+	return rules, nil
+}
+
+// repoLocation returns the location of a repo host in format
+// '[location]-[format].pkg.dev', e.g. 'us' for 'us-go.pkg.dev'.
+func repoLocation(host string) (string, error) {
+	location, _, ok := strings.Cut(strings.TrimSuffix(host, ".pkg.dev"), ".")
+	if ok {
+		return "", fmt.Errorf("host %q not in format '[location]-[format].pkg.dev'", host)
+	}
+	i := strings.LastIndex(location, "-")
+	if i <= 0 {
+		return "", fmt.Errorf("host %q not in format '[location]-[format].pkg.dev'", host)
+	}
+	return location[:i], nil
+}
+
+// refresh keeps calling fn to refresh the credential in the background if
+// enabled, until the background refresh duration passes, the context is
+// cancelled or it fails after retries. The expiry is when the current
+// credential expires.
+//
+// fn sets the credential, or removes it if remove is true. It's only asked to
+// remove with --cleanup-on-exit, once more when refresh stops, so the
+// credential it wrote doesn't outlive the refresh.
+func (f *CommonFlags) refresh(ctx context.Context, expiry time.Time, fn func(ctx context.Context, remove bool) (time.Time, error)) error {
+	if f.backgroundRefreshInterval <= 0 {
+		return nil
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, f.backgroundRefreshDuration)
+	defer cancel()
+
+	s := &refresh.Scheduler{
+		Interval: f.backgroundRefreshInterval,
+		Fraction: f.backgroundRefreshFraction,
+	}
+	err := s.Run(runCtx, expiry, func(ctx context.Context) (time.Time, error) {
+		expiry, err := fn(ctx, false)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to refresh credential: %w", err)
+		}
+		return expiry, nil
+	})
+
+	if f.cleanupOnExit {
+		// The context is likely done already, which must not stop the cleanup.
+		if _, cleanupErr := fn(context.WithoutCancel(ctx), true); cleanupErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to clean up credential: %w", cleanupErr))
+		}
+	}
+	return err
+}
+
 // If validate was called, then should return no error.
 func (f *CommonFlags) repoHosts() ([]string, error) {
 	if err := f.parseURLs(); err != nil {
@@ -73,26 +251,51 @@ func (f *CommonFlags) repoHosts() ([]string, error) {
 	return hosts, nil
 }
 
-func (f *CommonFlags) parseURLs() (merr error) {
+// repos returns the repo URLs in format '*.pkg.dev/[project]/[repo]'.
+// If validate was called, then should return no error.
+func (f *CommonFlags) repos() ([]string, error) {
+	if err := f.parseURLs(); err != nil {
+		return nil, err
+	}
+
+	repos := make([]string, 0, len(f.parsedURLs))
+	for _, u := range f.parsedURLs {
+		repos = append(repos, u.Host+strings.TrimSuffix(u.Path, "/"))
+	}
+	return repos, nil
+}
+
+// parseURLs parses the repo URLs once, and returns the same error on every
+// call.
+func (f *CommonFlags) parseURLs() error {
 	f.once.Do(func() {
 		for _, h := range f.repoURLs {
-			if !strings.HasPrefix(h, "https://") {
-				h = "https://" + h
-			}
-			u, err := url.Parse(h)
+			u, err := parseRepoURL(h)
 			if err != nil {
-				merr = errors.Join(merr, fmt.Errorf("failed to parse host %q: %w", h, err))
-				continue
-			}
-			if !strings.HasSuffix(u.Host, ".pkg.dev") || len(strings.Split(strings.Trim(u.Path, "/"), "/")) != 2 {
-				merr = errors.Join(merr, fmt.Errorf("repo URL %q not in format '*.pkg.dev/[project]/[repo]'", u.String()))
+				f.parseErr = errors.Join(f.parseErr, err)
 				continue
 			}
 			f.parsedURLs = append(f.parsedURLs, u)
 		}
 	})
 
-	return
+	return f.parseErr
+}
+
+// parseRepoURL parses a repo URL in format '*.pkg.dev/[project]/[repo]', with
+// or without the https scheme.
+func parseRepoURL(h string) (*url.URL, error) {
+	if !strings.HasPrefix(h, "https://") {
+		h = "https://" + h
+	}
+	u, err := url.Parse(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host %q: %w", h, err)
+	}
+	if !strings.HasSuffix(u.Host, ".pkg.dev") || len(strings.Split(strings.Trim(u.Path, "/"), "/")) != 2 {
+		return nil, fmt.Errorf("repo URL %q not in format '*.pkg.dev/[project]/[repo]'", u.String())
+	}
+	return u, nil
 }
 
 func (f *CommonFlags) setSection(set *cli.FlagSet) *cli.FlagSet {
@@ -105,25 +308,19 @@ func (f *CommonFlags) setSection(set *cli.FlagSet) *cli.FlagSet {
 		EnvVar:  "AR_CRED_HELPER_HOSTS",
 		Example: "us-go.pkg.dev/my-project/repo1,asia-maven.pkg.dev/my-project/repo2",
 	})
+	f.addFlags(sec)
 
-	sec.StringVar(&cli.StringVar{
-		Name:    "access-token-from-env",
-		Usage:   "The env var name to load the access token from. This is useful when it's another process that produces the access token.",
-		Target:  &f.accessTokenFromEnv,
-		EnvVar:  "AR_CRED_HELPER_ACCESS_TOKEN_FROM_ENV",
-		Example: "AR_CRED_HELPER_ACCESS_TOKEN",
-	})
+	return set
+}
 
-	sec.StringVar(&cli.StringVar{
-		Name:   "json-key",
-		Usage:  "The path to the JSON key of a service account used for authentication. Setting this flag will result in using JSON key for authentication instead of access token.",
-		Target: &f.jsonKeyPath,
-		EnvVar: "AR_CRED_HELPER_JSON_KEY",
-	})
+// addFlags adds the common flags other than --repo-urls to the section, for
+// commands that get the repos elsewhere.
+func (f *CommonFlags) addFlags(sec *cli.FlagSection) {
+	f.addAuthFlags(sec)
 
 	sec.DurationVar(&cli.DurationVar{
 		Name:    "background-refresh-interval",
-		Usage:   "If set, the program will keep running and refresh the credential per given interval, in which case it's best to put this program into background. Recommended value: 5m.",
+		Usage:   "If set, the program will keep running and refresh the credential before it expires, in which case it's best to put this program into background. The interval is used when the credential expiry is unknown, e.g. with --json-key or --access-token-from-env. Recommended value: 5m.",
 		Target:  &f.backgroundRefreshInterval,
 		EnvVar:  "AR_CRED_HELPER_BACKGROUND_REFRESH_INTERVAL",
 		Example: "5m",
@@ -138,5 +335,113 @@ func (f *CommonFlags) setSection(set *cli.FlagSet) *cli.FlagSet {
 		Example: "12h",
 	})
 
-	return set
+	sec.Float64Var(&cli.Float64Var{
+		Name:    "background-refresh-fraction",
+		Usage:   "The fraction of the remaining lifetime of the credential to wait before refreshing it in the background. Failed refreshes are retried with exponential backoff.",
+		Target:  &f.backgroundRefreshFraction,
+		Default: refresh.DefaultFraction,
+		EnvVar:  "AR_CRED_HELPER_BACKGROUND_REFRESH_FRACTION",
+		Example: "0.5",
+	})
+
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "remove",
+		Usage:  "Remove the Artifact Registry credentials of the repos instead of setting them, or all Artifact Registry credentials if --repo-urls is not set. Other entries in the file are left intact.",
+		Target: &f.remove,
+		EnvVar: "AR_CRED_HELPER_REMOVE",
+	})
+
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "cleanup-on-exit",
+		Usage:  "Remove the Artifact Registry credentials written by the background refresh when it stops, e.g. after --background-refresh-duration or on SIGTERM, so no stale credential is left behind. Other entries in the file are left intact.",
+		Target: &f.cleanupOnExit,
+		EnvVar: "AR_CRED_HELPER_CLEANUP_ON_EXIT",
+	})
+
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "dry-run",
+		Usage:  "Print a unified diff of the file with secrets redacted instead of writing it.",
+		Target: &f.dryRun,
+		EnvVar: "AR_CRED_HELPER_DRY_RUN",
+	})
+}
+
+// addAuthFlags adds the flags of where the credential comes from, for commands
+// that use the credential without writing it.
+func (f *CommonFlags) addAuthFlags(sec *cli.FlagSection) {
+	f.addTokenFlags(sec)
+
+	sec.StringVar(&cli.StringVar{
+		Name:   "json-key",
+		Usage:  "The path to the JSON key of a service account used for authentication. Setting this flag will result in using JSON key for authentication instead of access token.",
+		Target: &f.jsonKeyPath,
+		EnvVar: "AR_CRED_HELPER_JSON_KEY",
+	})
+
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "downscope",
+		Usage:  "EXPERIMENTAL. Downscope the access token with a Credential Access Boundary limited to --downscope-role on exactly the repos, so only the downscoped token is used. The boundary is exchanged at the Security Token Service, see --downscope-sts-endpoint. Credential Access Boundaries are only documented for Cloud Storage, so Artifact Registry may reject the downscoped token.",
+		Target: &f.downscope,
+		EnvVar: "AR_CRED_HELPER_DOWNSCOPE",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "downscope-role",
+		Usage:   "The Artifact Registry role the downscoped token is limited to, one of 'reader' or 'writer'.",
+		Target:  &f.downscopeRole,
+		Default: "reader",
+		EnvVar:  "AR_CRED_HELPER_DOWNSCOPE_ROLE",
+		Example: "writer",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "downscope-sts-endpoint",
+		Usage:   "Override the Security Token Service endpoint used with --downscope, separate from --sts-endpoint of the credential configuration. Default to the global endpoint.",
+		Target:  &f.downscopeSTSEndpoint,
+		EnvVar:  "AR_CRED_HELPER_DOWNSCOPE_STS_ENDPOINT",
+		Example: auth.DefaultSTSEndpoint,
+	})
+}
+
+// addTokenFlags adds the flags of where access tokens come from, for commands
+// that only use access tokens.
+func (f *CommonFlags) addTokenFlags(sec *cli.FlagSection) {
+	sec.StringVar(&cli.StringVar{
+		Name:    "access-token-from-env",
+		Usage:   "The env var name to load the access token from. This is useful when it's another process that produces the access token.",
+		Target:  &f.accessTokenFromEnv,
+		EnvVar:  "AR_CRED_HELPER_ACCESS_TOKEN_FROM_ENV",
+		Example: "AR_CRED_HELPER_ACCESS_TOKEN",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:   "credential-config",
+		Usage:  "The path to an external_account credential configuration file of Workload Identity Federation. The subject token is exchanged for an access token at the Security Token Service.",
+		Target: &f.credentialConfig,
+		EnvVar: "AR_CRED_HELPER_CREDENTIAL_CONFIG",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "sts-endpoint",
+		Usage:   "Override the Security Token Service endpoint used with --credential-config. Default to the token_url in the credential configuration.",
+		Target:  &f.stsEndpoint,
+		EnvVar:  "AR_CRED_HELPER_STS_ENDPOINT",
+		Example: auth.DefaultSTSEndpoint,
+	})
+
+	sec.StringSliceVar(&cli.StringSliceVar{
+		Name:    "impersonate-service-account",
+		Usage:   "The service account to impersonate with the access token, which is then used instead. For a delegation chain, list the delegates in order followed by the target service account.",
+		Target:  &f.impersonateServiceAccount,
+		EnvVar:  "AR_CRED_HELPER_IMPERSONATE_SERVICE_ACCOUNT",
+		Example: "reader@my-project.iam.gserviceaccount.com",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "iam-credentials-endpoint",
+		Usage:   "Override the IAM Credentials API endpoint used with --impersonate-service-account.",
+		Target:  &f.iamCredentialsEndpoint,
+		EnvVar:  "AR_CRED_HELPER_IAM_CREDENTIALS_ENDPOINT",
+		Example: auth.DefaultIAMCredentialsEndpoint,
+	})
 }
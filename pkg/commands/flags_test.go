@@ -1,10 +1,14 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
 )
 
 func TestCommonFlags_validate(t *testing.T) {
@@ -30,6 +34,22 @@ func TestCommonFlags_validate(t *testing.T) {
 			},
 			wantErr: "no host specified",
 		},
+		{
+			name: "remove without hosts",
+			flags: &CommonFlags{
+				remove: true,
+			},
+			wantErr: "",
+		},
+		{
+			name: "remove with background refresh",
+			flags: &CommonFlags{
+				repoURLs:                  []string{"us-go.pkg.dev/my-project/repo1"},
+				remove:                    true,
+				backgroundRefreshInterval: 5 * time.Minute,
+			},
+			wantErr: "--remove cannot be used with --background-refresh-interval",
+		},
 		{
 			name: "invalid url format",
 			flags: &CommonFlags{
@@ -53,7 +73,7 @@ func TestCommonFlags_validate(t *testing.T) {
 				repoURLs:                  []string{"us-go.pkg.dev/my-project/repo1"},
 				backgroundRefreshInterval: 1 * time.Minute,
 			},
-			wantErr: "background refresh interval must be at least 2 minutes",
+			wantErr: "invalid --background-refresh-interval: refresh interval must be at least 2m0s",
 		},
 	}
 
@@ -88,7 +108,7 @@ func TestCommonFlags_validateWithoutURLs(t *testing.T) {
 			flags: &CommonFlags{
 				backgroundRefreshInterval: 1 * time.Minute,
 			},
-			wantErr: "background refresh interval must be at least 2 minutes",
+			wantErr: "invalid --background-refresh-interval: refresh interval must be at least 2m0s",
 		},
 		{
 			name: "both auth methods set",
@@ -98,6 +118,80 @@ func TestCommonFlags_validateWithoutURLs(t *testing.T) {
 			},
 			wantErr: "only one of --json-key or --access-token-from-env can be set",
 		},
+		{
+			name: "credential config with access token",
+			flags: &CommonFlags{
+				credentialConfig:   "/path/to/config.json",
+				accessTokenFromEnv: "TOKEN",
+			},
+			wantErr: "--credential-config cannot be used with --json-key or --access-token-from-env",
+		},
+		{
+			name: "impersonation with json key",
+			flags: &CommonFlags{
+				jsonKeyPath:               "/path/to/key.json",
+				impersonateServiceAccount: []string{"reader@proj.iam.gserviceaccount.com"},
+			},
+			wantErr: "--impersonate-service-account cannot be used with --json-key",
+		},
+		{
+			name: "downscope with unknown role",
+			flags: &CommonFlags{
+				repoURLs:      []string{"us-go.pkg.dev/my-project/repo1"},
+				downscope:     true,
+				downscopeRole: "admin",
+			},
+			wantErr: `downscope role must be one of "reader" or "writer", got "admin"`,
+		},
+		{
+			name: "downscope without repo urls",
+			flags: &CommonFlags{
+				downscope:     true,
+				downscopeRole: "reader",
+			},
+			wantErr: "--downscope requires --repo-urls",
+		},
+		{
+			name: "downscope with invalid repo url",
+			flags: &CommonFlags{
+				repoURLs:      []string{"https://invalid-url"},
+				downscope:     true,
+				downscopeRole: "reader",
+			},
+			wantErr: `repo URL "https://invalid-url" not in format '*.pkg.dev/[project]/[repo]'`,
+		},
+		{
+			name: "downscope with host without location",
+			flags: &CommonFlags{
+				repoURLs:      []string{"go.pkg.dev/my-project/repo1"},
+				downscope:     true,
+				downscopeRole: "reader",
+			},
+			wantErr: `host "go.pkg.dev" not in format '[location]-[format].pkg.dev'`,
+		},
+		{
+			name: "refresh fraction out of range",
+			flags: &CommonFlags{
+				backgroundRefreshInterval: 5 * time.Minute,
+				backgroundRefreshFraction: 1.5,
+			},
+			wantErr: "invalid --background-refresh-fraction: refresh fraction must be at least 0 and less than 1, got 1.5",
+		},
+		{
+			name: "cleanup on exit without background refresh",
+			flags: &CommonFlags{
+				cleanupOnExit: true,
+			},
+			wantErr: "--cleanup-on-exit requires --background-refresh-interval",
+		},
+		{
+			name: "dry run with background refresh",
+			flags: &CommonFlags{
+				backgroundRefreshInterval: 5 * time.Minute,
+				dryRun:                    true,
+			},
+			wantErr: "--dry-run cannot be used with --background-refresh-interval",
+		},
 		{
 			name: "zero refresh interval",
 			flags: &CommonFlags{
@@ -117,3 +211,204 @@ func TestCommonFlags_validateWithoutURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestCommonFlags_accessBoundary(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		flags   *CommonFlags
+		want    []auth.AccessBoundaryRule
+		wantErr string
+	}{
+		{
+			name: "reader",
+			flags: &CommonFlags{
+				repoURLs:      []string{"us-go.pkg.dev/my-project/repo1", "europe-west1-docker.pkg.dev/my-project/repo2"},
+				downscopeRole: "reader",
+			},
+			want: []auth.AccessBoundaryRule{
+				{
+					AvailableResource:    "//artifactregistry.googleapis.com/projects/my-project/locations/us/repositories/repo1",
+					AvailablePermissions: []string{"inRole:roles/artifactregistry.reader"},
+				},
+				{
+					AvailableResource:    "//artifactregistry.googleapis.com/projects/my-project/locations/europe-west1/repositories/repo2",
+					AvailablePermissions: []string{"inRole:roles/artifactregistry.reader"},
+				},
+			},
+		},
+		{
+			name: "writer",
+			flags: &CommonFlags{
+				repoURLs:      []string{"asia-northeast1-python.pkg.dev/my-project/repo1"},
+				downscopeRole: "writer",
+			},
+			want: []auth.AccessBoundaryRule{{
+				AvailableResource:    "//artifactregistry.googleapis.com/projects/my-project/locations/asia-northeast1/repositories/repo1",
+				AvailablePermissions: []string{"inRole:roles/artifactregistry.writer"},
+			}},
+		},
+		{
+			name: "host without location",
+			flags: &CommonFlags{
+				repoURLs:      []string{"go.pkg.dev/my-project/repo1"},
+				downscopeRole: "reader",
+			},
+			wantErr: `host "go.pkg.dev" not in format '[location]-[format].pkg.dev'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.flags.accessBoundary()
+			if diff := testutil.DiffErrString(err, tt.wantErr); diff != "" {
+				t.Fatalf("CommonFlags.accessBoundary() %s", diff)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("CommonFlags.accessBoundary() (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCommonFlags_tokenOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		flags   *CommonFlags
+		wantErr string
+	}{
+		{
+			name: "downscope",
+			flags: &CommonFlags{
+				repoURLs:      []string{"us-go.pkg.dev/my-project/repo1"},
+				downscope:     true,
+				downscopeRole: "reader",
+			},
+		},
+		{
+			name: "downscope with invalid repo url",
+			flags: &CommonFlags{
+				repoURLs:      []string{"https://invalid-url"},
+				downscope:     true,
+				downscopeRole: "reader",
+			},
+			wantErr: `repo URL "https://invalid-url" not in format '*.pkg.dev/[project]/[repo]'`,
+		},
+		{
+			name: "downscope without repo urls",
+			flags: &CommonFlags{
+				downscope:     true,
+				downscopeRole: "reader",
+			},
+			wantErr: "--downscope requires --repo-urls",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Parsing twice must not lose the error.
+			_ = tt.flags.parseURLs()
+			opts, err := tt.flags.tokenOptions()
+			if diff := testutil.DiffErrString(err, tt.wantErr); diff != "" {
+				t.Fatalf("CommonFlags.tokenOptions() %s", diff)
+			}
+			if err == nil && len(opts.accessBoundary) == 0 {
+				t.Errorf("CommonFlags.tokenOptions() got no access boundary")
+			}
+		})
+	}
+}
+
+func TestCommonFlags_refresh(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		flags       *CommonFlags
+		cancel      bool
+		cleanupErr  error
+		wantRemoved bool
+		wantErr     string
+	}{
+		{
+			name: "duration passes",
+			flags: &CommonFlags{
+				backgroundRefreshInterval: 5 * time.Minute,
+				backgroundRefreshDuration: 10 * time.Millisecond,
+			},
+			wantErr: context.DeadlineExceeded.Error(),
+		},
+		{
+			name: "cleanup when duration passes",
+			flags: &CommonFlags{
+				backgroundRefreshInterval: 5 * time.Minute,
+				backgroundRefreshDuration: 10 * time.Millisecond,
+				cleanupOnExit:             true,
+			},
+			wantRemoved: true,
+			wantErr:     context.DeadlineExceeded.Error(),
+		},
+		{
+			name: "cleanup when cancelled",
+			flags: &CommonFlags{
+				backgroundRefreshInterval: 5 * time.Minute,
+				backgroundRefreshDuration: time.Hour,
+				cleanupOnExit:             true,
+			},
+			cancel:      true,
+			wantRemoved: true,
+			wantErr:     context.Canceled.Error(),
+		},
+		{
+			name: "cleanup failure",
+			flags: &CommonFlags{
+				backgroundRefreshInterval: 5 * time.Minute,
+				backgroundRefreshDuration: 10 * time.Millisecond,
+				cleanupOnExit:             true,
+			},
+			cleanupErr:  errors.New("disk full"),
+			wantRemoved: true,
+			wantErr:     "failed to clean up credential: disk full",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			var removed bool
+			err := tt.flags.refresh(ctx, time.Time{}, func(ctx context.Context, remove bool) (time.Time, error) {
+				if ctx.Err() != nil {
+					t.Errorf("fn called with done context: %v", ctx.Err())
+				}
+				if remove {
+					removed = true
+					return time.Time{}, tt.cleanupErr
+				}
+				return time.Time{}, nil
+			})
+			if diff := testutil.DiffErrString(err, tt.wantErr); diff != "" {
+				t.Errorf("CommonFlags.refresh() %s", diff)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("CommonFlags.refresh() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			if tt.flags.remove {
+				t.Error("CommonFlags.refresh() changed --remove")
+			}
+		})
+	}
+}
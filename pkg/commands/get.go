@@ -1,19 +1,32 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/abcxyz/pkg/cli"
 )
 
+const (
+	formatCredentialHelper = "credential-helper"
+	formatGoAuth           = "goauth"
+)
+
 type GetCommand struct {
 	baseCommand
 
-	hosts []string
-	// jsonKey string
+	hosts       []string
+	format      string
+	commonFlags *CommonFlags
+	daemonFlags daemonClientFlags
 }
 
 func (c *GetCommand) Desc() string {
@@ -31,10 +44,29 @@ There are two ways to specify the host(s) to get credential for:
 2. Pass a request JSON payload to the stdin. 
    See schema at: https://github.com/EngFlow/credential-helper-spec/blob/main/schemas/get-credentials-request.schema.json.
    This makes the tool comformant to the credential-helper-spec.
+
+By default, the credential is an OAuth2 access token from Application Default
+Credentials or gcloud, sent as a Bearer token. With --credential-config, the
+access token is from a Workload Identity Federation credential configuration
+instead. With --impersonate-service-account, the access token is used to
+impersonate the service account, whose access token is sent instead. With
+--json-key, the service account JSON key is sent with Basic authentication
+instead. With --use-daemon, the access token is from a running daemon instead,
+see the daemon command.
+
+With --format=goauth, the output follows Go's GOAUTH command protocol (Go 1.24+)
+instead. The hosts are taken from --hosts or the URL argument Go passes when
+retrying a request. See 'go help goauth'. Hosts other than '*.pkg.dev', or no
+host at all, get no credentials rather than an error, so the same GOAUTH works
+for modules outside Artifact Registry.
+
+  # Example: Use fresh tokens for Go modules in Artifact Registry
+  export GOAUTH='artifact-registry-cred-helper get --format=goauth --hosts=us-go.pkg.dev'
 `
 }
 
 func (c *GetCommand) Flags() *cli.FlagSet {
+	c.commonFlags = &CommonFlags{}
 	set := c.NewFlagSet()
 	sec := set.NewSection("OPTIONS")
 
@@ -46,12 +78,25 @@ func (c *GetCommand) Flags() *cli.FlagSet {
 		Example: "us-go.pkg.dev,eu-python.pkg.dev,asia-maven.pkg.dev",
 	})
 
-	// sec.StringVar(&cli.StringVar{
-	// 	Name:   "json-key",
-	// 	Usage:  "The path to the JSON key of a service account used for authentication. Leave empty to use oauth token instead.",
-	// 	Target: &c.jsonKey,
-	// 	EnvVar: "AR_CRED_HELPER_JSON_KEY",
-	// })
+	sec.StringVar(&cli.StringVar{
+		Name:    "format",
+		Usage:   "The output format, one of 'credential-helper' or 'goauth'.",
+		Target:  &c.format,
+		Default: formatCredentialHelper,
+		EnvVar:  "AR_CRED_HELPER_GET_FORMAT",
+		Example: formatGoAuth,
+	})
+
+	c.commonFlags.addTokenFlags(sec)
+
+	sec.StringVar(&cli.StringVar{
+		Name:   "json-key",
+		Usage:  "The path to the JSON key of a service account used for authentication. Setting this flag will result in Basic authentication with the JSON key instead of access token.",
+		Target: &c.commonFlags.jsonKeyPath,
+		EnvVar: "AR_CRED_HELPER_JSON_KEY",
+	})
+
+	c.daemonFlags.addFlags(sec)
 
 	return set
 }
@@ -61,34 +106,74 @@ func (c *GetCommand) Run(ctx context.Context, args []string) error {
 	if err := f.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	if err := c.commonFlags.validateWithoutURLs(); err != nil {
+		return err
+	}
+	cf := c.commonFlags
+	if c.daemonFlags.useDaemon && (cf.jsonKeyPath != "" || cf.accessTokenFromEnv != "" || cf.credentialConfig != "" || len(cf.impersonateServiceAccount) > 0) {
+		return fmt.Errorf("--use-daemon cannot be used with --json-key, --access-token-from-env, --credential-config or --impersonate-service-account")
+	}
 
 	var hosts []string
-	if len(c.hosts) > 0 {
+	switch c.format {
+	case formatCredentialHelper:
+		if len(c.hosts) > 0 {
+			hosts = c.hosts
+		} else {
+			b, err := io.ReadAll(c.Stdin())
+			if err != nil {
+				return fmt.Errorf("failed to read stdin: %w", err)
+			}
+			h, err := decodeReq(b)
+			if err != nil {
+				return err
+			}
+			hosts = []string{h}
+		}
+	case formatGoAuth:
+		// Go passes the URL as the argument when retrying after a 4xx response,
+		// with the response on stdin, which we don't need.
 		hosts = c.hosts
-	} else {
-		b, err := io.ReadAll(c.Stdin())
-		if err != nil {
-			return fmt.Errorf("failed to read stdin: %w", err)
+		if len(hosts) == 0 {
+			for _, a := range f.Args() {
+				h, err := hostFromURI(a)
+				if err != nil {
+					return err
+				}
+				hosts = append(hosts, h)
+			}
 		}
-		h, err := decodeReq(b)
-		if err != nil {
-			return err
+
+		// Go runs GOAUTH for every fetch, first without a URL, and an error
+		// fails the fetch. So hosts other than Artifact Registry, or no host at
+		// all, get no credentials instead of an error.
+		hosts = slices.DeleteFunc(hosts, func(h string) bool {
+			return !strings.HasSuffix(h, ".pkg.dev")
+		})
+		if len(hosts) == 0 {
+			return nil
 		}
-		hosts = []string{h}
+	default:
+		return fmt.Errorf("unknown format %q, must be one of %q or %q", c.format, formatCredentialHelper, formatGoAuth)
 	}
 
 	if err := validateHosts(hosts); err != nil {
 		return err
 	}
 
-	token, err := c.getAuthToken(ctx)
+	authz, expiry, err := c.authorization(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
+		return err
 	}
 
-	out, err := encodeResp(token)
-	if err != nil {
-		return err
+	var out []byte
+	if c.format == formatGoAuth {
+		out = encodeGoAuthResp(hosts, authz)
+	} else {
+		out, err = encodeResp(authz, expiry)
+		if err != nil {
+			return err
+		}
 	}
 
 	if _, err := c.Stdout().Write(out); err != nil {
@@ -98,23 +183,87 @@ func (c *GetCommand) Run(ctx context.Context, args []string) error {
 	return nil
 }
 
+// authorization returns the value of the Authorization header and when it
+// expires. A zero expiry means unknown.
+func (c *GetCommand) authorization(ctx context.Context) (string, time.Time, error) {
+	if c.commonFlags.jsonKeyPath != "" {
+		k, err := c.getEncodedJSONKey(c.commonFlags.jsonKeyPath)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to encode JSON key: %w", err)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte("_json_key_base64:"+k)), time.Time{}, nil
+	}
+
+	opts := c.daemonFlags.tokenOptions()
+	if !c.daemonFlags.useDaemon {
+		var err error
+		if opts, err = c.commonFlags.tokenOptions(); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	token, err := c.token(ctx, opts)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return "Bearer " + token.Value, token.Expiry, nil
+}
+
+// decodeReq returns the host of the "uri" in a credential-helper-spec request.
 func decodeReq(req []byte) (string, error) {
-	v := map[string]string{}
+	var v struct {
+		URI string `json:"uri"`
+	}
 	if err := json.Unmarshal(req, &v); err != nil {
 		return "", fmt.Errorf("failed to parse request: %w", err)
 	}
-	return v["uri"], nil
+	if v.URI == "" {
+		return "", fmt.Errorf("request has no \"uri\"")
+	}
+	return hostFromURI(v.URI)
+}
+
+// hostFromURI returns the host of the URI, which may or may not have a scheme.
+func hostFromURI(uri string) (string, error) {
+	if !strings.Contains(uri, "://") {
+		uri = "https://" + uri
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse uri %q: %w", uri, err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("uri %q has no host", uri)
+	}
+	return u.Hostname(), nil
 }
 
-func encodeResp(token string) ([]byte, error) {
+// encodeResp encodes a credential-helper-spec response. The expires field is
+// omitted if the expiry is unknown.
+func encodeResp(authz string, expiry time.Time) ([]byte, error) {
 	v := map[string]any{
 		"headers": map[string][]string{
-			"Authorization": {"Bearer " + token},
+			"Authorization": {authz},
 		},
 	}
+	if !expiry.IsZero() {
+		v["expires"] = expiry.UTC().Format(time.RFC3339)
+	}
 	b, err := json.Marshal(v)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode response: %w", err)
 	}
 	return b, nil
 }
+
+// encodeGoAuthResp encodes a single credential set of the GOAUTH command
+// protocol, i.e. URL lines, a blank line, header lines and a blank line.
+func encodeGoAuthResp(hosts []string, authz string) []byte {
+	var b bytes.Buffer
+	for _, h := range hosts {
+		fmt.Fprintf(&b, "https://%s/\n", h)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "Authorization: %s\n", authz)
+	b.WriteString("\n")
+	return b.Bytes()
+}
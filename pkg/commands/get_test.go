@@ -3,12 +3,15 @@ package commands
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/abcxyz/pkg/testutil"
 	"github.com/google/go-cmp/cmp"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
 )
 
 func TestGetCommand_Run(t *testing.T) {
@@ -18,43 +21,92 @@ func TestGetCommand_Run(t *testing.T) {
 		name          string
 		args          []string
 		stdin         string
-		getAuthToken  authTokenGetter
+		tokenProvider auth.TokenProvider
 		expectedHosts []string
 		expectedErr   string
 		expectedOut   string
+		expectedRaw   string
 	}{
 		{
-			name: "valid hosts flag",
-			args: []string{"--hosts", "us-go.pkg.dev"},
-			getAuthToken: func(ctx context.Context) (string, error) {
-				return "test-token", nil
-			},
+			name:          "valid hosts flag",
+			args:          []string{"--hosts", "us-go.pkg.dev"},
+			tokenProvider: auth.Static{Value: "test-token"},
 			expectedHosts: []string{"us-go.pkg.dev"},
 			expectedOut:   `{"headers":{"Authorization":["Bearer test-token"]}}`,
 		},
 		{
-			name:  "valid stdin",
-			stdin: `{"uri": "us-go.pkg.dev"}`,
-			getAuthToken: func(ctx context.Context) (string, error) {
-				return "test-token", nil
-			},
+			name:          "valid stdin",
+			stdin:         `{"uri": "us-go.pkg.dev"}`,
+			tokenProvider: auth.Static{Value: "test-token"},
 			expectedHosts: []string{"us-go.pkg.dev"},
 			expectedOut:   `{"headers":{"Authorization":["Bearer test-token"]}}`,
 		},
 		{
-			name: "invalid host",
-			args: []string{"--hosts", "invalid-host"},
-			getAuthToken: func(ctx context.Context) (string, error) {
-				return "test-token", nil
-			},
-			expectedErr: "host \"invalid-host\" doesn't have domain '.pkg.dev'",
+			name:          "stdin with full uri and expiry",
+			stdin:         `{"uri": "https://us-go.pkg.dev/my-project/repo1"}`,
+			tokenProvider: auth.Static{Value: "test-token", Expiry: time.Date(2025, 1, 2, 3, 4, 5, 0, time.FixedZone("PST", -8*60*60))},
+			expectedOut:   `{"headers":{"Authorization":["Bearer test-token"]},"expires":"2025-01-02T11:04:05Z"}`,
+		},
+		{
+			name:        "stdin without uri",
+			stdin:       `{"url": "us-go.pkg.dev"}`,
+			expectedErr: `request has no "uri"`,
 		},
 		{
-			name: "getAuthToken error",
+			name:        "stdin malformed",
+			stdin:       `{"uri": `,
+			expectedErr: "failed to parse request",
+		},
+		{
+			name:        "stdin uri without host",
+			stdin:       `{"uri": "https:///foo"}`,
+			expectedErr: "has no host",
+		},
+		{
+			name:          "invalid host",
+			args:          []string{"--hosts", "invalid-host"},
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedErr:   "host \"invalid-host\" doesn't have domain '.pkg.dev'",
+		},
+		{
+			name:          "goauth with hosts flag",
+			args:          []string{"--format", "goauth", "--hosts", "us-go.pkg.dev,eu-go.pkg.dev"},
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedRaw:   "https://us-go.pkg.dev/\nhttps://eu-go.pkg.dev/\n\nAuthorization: Bearer test-token\n\n",
+		},
+		{
+			name:          "goauth with URL argument",
+			args:          []string{"--format=goauth", "https://us-go.pkg.dev/my-project/repo1/example.com/mod/@v/list"},
+			stdin:         "HTTP/1.1 401 Unauthorized\n\n",
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedRaw:   "https://us-go.pkg.dev/\n\nAuthorization: Bearer test-token\n\n",
+		},
+		{
+			name: "goauth without hosts",
+			args: []string{"--format=goauth"},
+		},
+		{
+			name:  "goauth with non Artifact Registry URL",
+			args:  []string{"--format=goauth", "https://github.com/my-org/private-module/@v/list"},
+			stdin: "HTTP/1.1 404 Not Found\n\n",
+		},
+		{
+			name:          "goauth skips non Artifact Registry hosts",
+			args:          []string{"--format=goauth", "--hosts", "github.com,us-go.pkg.dev"},
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedRaw:   "https://us-go.pkg.dev/\n\nAuthorization: Bearer test-token\n\n",
+		},
+		{
+			name:        "unknown format",
+			args:        []string{"--format=netrc", "--hosts", "us-go.pkg.dev"},
+			expectedErr: `unknown format "netrc"`,
+		},
+		{
+			name: "token provider error",
 			args: []string{"--hosts", "us-go.pkg.dev"},
-			getAuthToken: func(ctx context.Context) (string, error) {
-				return "", fmt.Errorf("token error")
-			},
+			tokenProvider: auth.TokenProviderFunc(func(context.Context) (*auth.Token, error) {
+				return nil, fmt.Errorf("token error")
+			}),
 			expectedErr: "failed to get access token: token error",
 		},
 	}
@@ -65,7 +117,7 @@ func TestGetCommand_Run(t *testing.T) {
 
 			cmd := &GetCommand{
 				baseCommand: baseCommand{
-					getAuthToken: tt.getAuthToken,
+					tokenProvider: tt.tokenProvider,
 				},
 			}
 
@@ -86,6 +138,19 @@ func TestGetCommand_Run(t *testing.T) {
 				return
 			}
 
+			// E.g. GOAUTH without an Artifact Registry host gets no credentials.
+			if tt.expectedRaw == "" && tt.expectedOut == "" {
+				if got := stdout.String(); got != "" {
+					t.Fatalf("expected no output, got %q", got)
+				}
+			}
+
+			if tt.expectedRaw != "" {
+				if got := stdout.String(); got != tt.expectedRaw {
+					t.Fatalf("expected output %q, got %q", tt.expectedRaw, got)
+				}
+			}
+
 			if tt.expectedOut != "" {
 				var got map[string]interface{}
 				if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
@@ -104,3 +169,105 @@ func TestGetCommand_Run(t *testing.T) {
 		})
 	}
 }
+
+// Disable parallel due to setting env vars.
+func TestGetCommand_Run_credentialSources(t *testing.T) {
+	credentialConfig, stsEndpoint := fakeCredentialConfig(t)
+	iamCredentialsEndpoint := fakeIAMCredentials(t)
+
+	tests := []struct {
+		name              string
+		args              []string
+		setEnv            map[string]string
+		getEncodedJSONKey encodedJSONKeyGetter
+		expectedErr       string
+		expectedAuthz     string
+	}{
+		{
+			name: "json key",
+			args: []string{"--hosts", "us-go.pkg.dev", "--json-key", "/path/to/key.json"},
+			getEncodedJSONKey: func(p string) (string, error) {
+				if p != "/path/to/key.json" {
+					return "", fmt.Errorf("unexpected path %q", p)
+				}
+				return "encoded-key", nil
+			},
+			expectedAuthz: "Basic " + base64.StdEncoding.EncodeToString([]byte("_json_key_base64:encoded-key")),
+		},
+		{
+			name: "json key error",
+			args: []string{"--hosts", "us-go.pkg.dev", "--json-key", "/path/to/key.json"},
+			getEncodedJSONKey: func(string) (string, error) {
+				return "", fmt.Errorf("no such file")
+			},
+			expectedErr: "failed to encode JSON key: no such file",
+		},
+		{
+			name:          "access token from env",
+			args:          []string{"--hosts", "us-go.pkg.dev", "--access-token-from-env", "TEST_GET_TOKEN"},
+			setEnv:        map[string]string{"TEST_GET_TOKEN": "env-token"},
+			expectedAuthz: "Bearer env-token",
+		},
+		{
+			name:        "access token from env not set",
+			args:        []string{"--hosts", "us-go.pkg.dev", "--access-token-from-env", "TEST_GET_TOKEN"},
+			expectedErr: `failed to get access token from env var "TEST_GET_TOKEN"`,
+		},
+		{
+			name:        "both set",
+			args:        []string{"--hosts", "us-go.pkg.dev", "--json-key", "/path/to/key.json", "--access-token-from-env", "TEST_GET_TOKEN"},
+			expectedErr: "only one of --json-key or --access-token-from-env can be set",
+		},
+		{
+			name:          "credential config",
+			args:          []string{"--hosts", "us-go.pkg.dev", "--credential-config", credentialConfig, "--sts-endpoint", stsEndpoint},
+			expectedAuthz: "Bearer sts-token",
+		},
+		{
+			name:          "impersonate service account from env token",
+			args:          []string{"--hosts", "us-go.pkg.dev", "--access-token-from-env", "TEST_GET_TOKEN", "--impersonate-service-account", "reader@proj.iam.gserviceaccount.com", "--iam-credentials-endpoint", iamCredentialsEndpoint},
+			setEnv:        map[string]string{"TEST_GET_TOKEN": "test-token"},
+			expectedAuthz: "Bearer impersonated-token",
+		},
+		{
+			name:        "credential config with json key",
+			args:        []string{"--hosts", "us-go.pkg.dev", "--credential-config", credentialConfig, "--json-key", "/path/to/key.json"},
+			expectedErr: "--credential-config cannot be used with --json-key or --access-token-from-env",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.setEnv {
+				t.Setenv(k, v)
+			}
+
+			cmd := &GetCommand{
+				baseCommand: baseCommand{
+					getEncodedJSONKey: tt.getEncodedJSONKey,
+				},
+			}
+			var stdout bytes.Buffer
+			cmd.SetStdout(&stdout)
+
+			err := cmd.Run(context.Background(), tt.args)
+			if diff := testutil.DiffErrString(err, tt.expectedErr); diff != "" {
+				t.Errorf("unexpected error: %s", diff)
+				return
+			}
+			if tt.expectedErr != "" {
+				return
+			}
+
+			var got struct {
+				Headers map[string][]string `json:"headers"`
+			}
+			if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+				t.Fatalf("failed to unmarshal output: %v", err)
+			}
+			if diff := cmp.Diff([]string{tt.expectedAuthz}, got.Headers["Authorization"]); diff != "" {
+				t.Errorf("Authorization header (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abcxyz/pkg/cli"
+)
+
+type GitCredentialCommand struct {
+	baseCommand
+
+	daemonFlags daemonClientFlags
+}
+
+func (c *GitCredentialCommand) Desc() string {
+	return "Act as a git credential helper for Artifact Registry."
+}
+
+func (c *GitCredentialCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [get|store|erase]
+
+Implement the git credential helper protocol for '*.pkg.dev' hosts.
+See: https://git-scm.com/docs/gitcredentials.
+
+  # Example: Use the helper for Go modules in Artifact Registry
+  git config --global credential.https://us-go.pkg.dev.helper '!artifact-registry-cred-helper git-credential'
+
+Credentials are always derived from the environment, so 'store' and 'erase' are
+no-ops. With --use-daemon, or AR_CRED_HELPER_USE_DAEMON=true, the access token
+is from a running daemon instead, see the daemon command.
+`
+}
+
+func (c *GitCredentialCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.daemonFlags.addFlags(set.NewSection("OPTIONS"))
+	return set
+}
+
+func (c *GitCredentialCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if len(f.Args()) != 1 {
+		return fmt.Errorf("expected exactly one operation of get, store or erase, got %q", f.Args())
+	}
+
+	switch op := f.Arg(0); op {
+	case "get":
+		return c.get(ctx)
+	case "store", "erase":
+		// Drain the input so the caller doesn't see a broken pipe.
+		if _, err := io.Copy(io.Discard, c.Stdin()); err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q", op)
+	}
+}
+
+func (c *GitCredentialCommand) get(ctx context.Context) error {
+	attrs, err := decodeGitCredentialReq(c.Stdin())
+	if err != nil {
+		return err
+	}
+
+	if p := attrs["protocol"]; p != "" && p != "https" {
+		return fmt.Errorf("protocol %q is not supported, only https", p)
+	}
+	// The host may include a port, which Artifact Registry doesn't use.
+	host, _, _ := strings.Cut(attrs["host"], ":")
+	if host == "" {
+		return fmt.Errorf("no host specified")
+	}
+	if err := validateHosts([]string{host}); err != nil {
+		return err
+	}
+
+	token, err := c.token(ctx, c.daemonFlags.tokenOptions())
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("protocol=https\n")
+	fmt.Fprintf(&b, "host=%s\n", attrs["host"])
+	b.WriteString("username=oauth2accesstoken\n")
+	fmt.Fprintf(&b, "password=%s\n", token.Value)
+
+	if _, err := c.Stdout().Write(b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return nil
+}
+
+// decodeGitCredentialReq reads the key=value lines of the git credential
+// protocol until a blank line or the end of input.
+func decodeGitCredentialReq(r io.Reader) (map[string]string, error) {
+	attrs := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("failed to parse request line %q", line)
+		}
+		attrs[k] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return attrs, nil
+}
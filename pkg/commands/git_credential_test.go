@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+func TestGitCredentialCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		args          []string
+		stdin         string
+		tokenProvider auth.TokenProvider
+		expectedErr   string
+		expectedOut   string
+	}{
+		{
+			name:          "get",
+			args:          []string{"get"},
+			stdin:         "protocol=https\nhost=us-go.pkg.dev\npath=my-project/repo1\n\n",
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedOut:   "protocol=https\nhost=us-go.pkg.dev\nusername=oauth2accesstoken\npassword=test-token\n",
+		},
+		{
+			name:          "get with port",
+			args:          []string{"get"},
+			stdin:         "protocol=https\nhost=us-go.pkg.dev:443\n",
+			tokenProvider: auth.Static{Value: "test-token"},
+			expectedOut:   "protocol=https\nhost=us-go.pkg.dev:443\nusername=oauth2accesstoken\npassword=test-token\n",
+		},
+		{
+			name:        "get other host",
+			args:        []string{"get"},
+			stdin:       "protocol=https\nhost=github.com\n\n",
+			expectedErr: "host \"github.com\" doesn't have domain '.pkg.dev'",
+		},
+		{
+			name:        "get http",
+			args:        []string{"get"},
+			stdin:       "protocol=http\nhost=us-go.pkg.dev\n\n",
+			expectedErr: `protocol "http" is not supported`,
+		},
+		{
+			name:        "get without host",
+			args:        []string{"get"},
+			stdin:       "protocol=https\n\n",
+			expectedErr: "no host specified",
+		},
+		{
+			name:        "get malformed",
+			args:        []string{"get"},
+			stdin:       "protocol\n\n",
+			expectedErr: `failed to parse request line "protocol"`,
+		},
+		{
+			name:  "token provider error",
+			args:  []string{"get"},
+			stdin: "protocol=https\nhost=us-go.pkg.dev\n\n",
+			tokenProvider: auth.TokenProviderFunc(func(context.Context) (*auth.Token, error) {
+				return nil, fmt.Errorf("token error")
+			}),
+			expectedErr: "failed to get access token: token error",
+		},
+		{
+			name:  "store is no-op",
+			args:  []string{"store"},
+			stdin: "protocol=https\nhost=us-go.pkg.dev\nusername=u\npassword=p\n\n",
+		},
+		{
+			name:  "erase is no-op",
+			args:  []string{"erase"},
+			stdin: "protocol=https\nhost=us-go.pkg.dev\n\n",
+		},
+		{
+			name:        "unknown operation",
+			args:        []string{"approve"},
+			expectedErr: `unknown operation "approve"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := &GitCredentialCommand{
+				baseCommand: baseCommand{
+					tokenProvider: tt.tokenProvider,
+				},
+			}
+
+			var stdin bytes.Buffer
+			stdin.WriteString(tt.stdin)
+			cmd.SetStdin(&stdin)
+
+			var stdout bytes.Buffer
+			cmd.SetStdout(&stdout)
+
+			err := cmd.Run(context.Background(), tt.args)
+			if diff := testutil.DiffErrString(err, tt.expectedErr); diff != "" {
+				t.Errorf("unexpected error: %s", diff)
+				return
+			}
+
+			if got := stdout.String(); got != tt.expectedOut {
+				t.Errorf("expected output %q, got %q", tt.expectedOut, got)
+			}
+		})
+	}
+}
@@ -5,51 +5,339 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/abcxyz/pkg/cli"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/apt"
 	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/daemon"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/docker"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/gradle"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/maven"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/netrc"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/npmrc"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/pip"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/pypirc"
 )
 
 type authConfig interface {
 	SetToken([]string, string)
 	SetJSONKey([]string, string)
+	// Remove removes the Artifact Registry credentials of the given keys, or
+	// all of them if no key is given.
+	Remove([]string)
 	Close() error
 }
 
-type authTokenGetter func(context.Context) (string, error)
 type encodedJSONKeyGetter func(string) (string, error)
 
 var (
-	defaultAuthTokenGetter      = auth.Token
+	defaultTokenProvider        = auth.Default{}
 	defaultEncodedJSONKeyGetter = auth.EncodeJSONKey
 )
 
 type baseCommand struct {
 	cli.BaseCommand
 
-	getAuthToken      authTokenGetter
+	tokenProvider     auth.TokenProvider
 	getEncodedJSONKey encodedJSONKeyGetter
 }
 
+// tokenOptions decide where access tokens come from.
+type tokenOptions struct {
+	accessTokenFromEnv string
+	credentialConfig   string
+	stsEndpoint        string
+
+	// impersonateServiceAccount is the delegation chain ending with the service
+	// account to impersonate.
+	impersonateServiceAccount []string
+	iamCredentialsEndpoint    string
+
+	// accessBoundary is the Credential Access Boundary to downscope the token
+	// with, if set, at downscopeSTSEndpoint.
+	accessBoundary       []auth.AccessBoundaryRule
+	downscopeSTSEndpoint string
+
+	// daemonSocket is the socket of the daemon to get the token from, if set.
+	daemonSocket string
+}
+
+// token returns an access token from the daemon if set, from the env var if
+// set, from the credential configuration if set, or else from the token
+// provider. The token is then used to impersonate the service account if set,
+// and downscoped with the access boundary if set.
+func (c *baseCommand) token(ctx context.Context, opts tokenOptions) (*auth.Token, error) {
+	var p auth.TokenProvider
+	switch {
+	case opts.daemonSocket != "":
+		p = &daemon.Client{SocketPath: opts.daemonSocket}
+	case opts.accessTokenFromEnv != "":
+		p = auth.Env{Name: opts.accessTokenFromEnv}
+	case opts.credentialConfig != "":
+		p = &auth.ExternalAccount{ConfigPath: opts.credentialConfig, STSEndpoint: opts.stsEndpoint}
+	default:
+		p = c.tokenProvider
+	}
+
+	if n := len(opts.impersonateServiceAccount); n > 0 {
+		p = &auth.Impersonate{
+			Base:           p,
+			ServiceAccount: opts.impersonateServiceAccount[n-1],
+			Delegates:      opts.impersonateServiceAccount[:n-1],
+			Endpoint:       opts.iamCredentialsEndpoint,
+		}
+	}
+
+	if len(opts.accessBoundary) > 0 {
+		p = &auth.Downscope{Base: p, Rules: opts.accessBoundary, STSEndpoint: opts.downscopeSTSEndpoint}
+	}
+
+	tk, err := p.Token(ctx)
+	if err != nil {
+		if _, ok := p.(auth.Env); ok {
+			return nil, err //nolint:wrapcheck // Already descriptive
+		}
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+	return tk, nil
+}
+
+// credential gets the credential per the flags, and returns how to set it for
+// the keys of a config and when it expires, zero if unknown. With remove, the
+// credential is removed instead.
+func (c *baseCommand) credential(ctx context.Context, f *CommonFlags, remove bool) (func(cfg authConfig, keys []string), time.Time, error) {
+	switch {
+	case remove:
+		return func(cfg authConfig, keys []string) { cfg.Remove(keys) }, time.Time{}, nil
+	case f.jsonKeyPath != "":
+		k, err := c.getEncodedJSONKey(f.jsonKeyPath)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to encode JSON key: %w", err)
+		}
+		return func(cfg authConfig, keys []string) { cfg.SetJSONKey(keys, k) }, time.Time{}, nil
+	default:
+		opts, err := f.tokenOptions()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		token, err := c.token(ctx, opts)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		return func(cfg authConfig, keys []string) { cfg.SetToken(keys, token.Value) }, token.Expiry, nil
+	}
+}
+
+// setCredential gets the credential per the flags, or none with remove, and
+// then sets it for the keys in the config file opened with open. It returns
+// when the credential expires, zero if unknown.
+func (c *baseCommand) setCredential(ctx context.Context, f *CommonFlags, open func() (previewableConfig, error), keys []string, remove bool) (time.Time, error) {
+	set, expiry, err := c.credential(ctx, f, remove)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := c.update(f, open, func(cfg authConfig) error {
+		set(cfg, keys)
+		return nil
+	}); err != nil {
+		return time.Time{}, err
+	}
+	return expiry, nil
+}
+
+// update opens the config file with open, which locks it where supported
+// unless --dry-run, calls set and closes it, or prints the diff with --dry-run. The credential
+// must be fetched before, so the lock isn't held while waiting on gcloud or a
+// token endpoint. The file is opened again on every update, so changes made by
+// others in between are kept.
+func (c *baseCommand) update(f *CommonFlags, open func() (previewableConfig, error), set func(cfg authConfig) error) (err error) {
+	cfg, err := open()
+	if err != nil {
+		return err
+	}
+	out := f.output(cfg, c.Stdout())
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return set(out)
+}
+
+// openOptions are how to open a config file, other than its path.
+type openOptions struct {
+	// merge only replaces the netrc or apt entries of the given hosts.
+	merge bool
+	// scope is the npm scope of the repos.
+	scope string
+	// repoIDs maps the repos to their .pypirc index server names.
+	repoIDs map[string]string
+	// unlocked opens the file without locking it, for --dry-run, since taking
+	// the lock creates the lock file and its dir.
+	unlocked bool
+}
+
+// openNetRC opens the netrc file at path, which locks it unless unlocked.
+func openNetRC(path string, opts openOptions) (previewableConfig, error) {
+	open := netrc.OpenLocked
+	if opts.unlocked {
+		open = netrc.Open
+	}
+	nrc, err := open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open .netrc file: %w", err)
+	}
+	nrc.SetMerge(opts.merge)
+	return nrc, nil
+}
+
+// openMaven opens the Maven settings.xml file at path, which locks it unless
+// unlocked.
+func openMaven(path string, opts openOptions) (previewableConfig, error) {
+	open := maven.OpenLocked
+	if opts.unlocked {
+		open = maven.Open
+	}
+	settings, err := open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Maven settings.xml file: %w", err)
+	}
+	return settings, nil
+}
+
+// openNPM opens the npmrc file at path, which locks it unless unlocked.
+func openNPM(path string, opts openOptions) (previewableConfig, error) {
+	open := npmrc.OpenLocked
+	if opts.unlocked {
+		open = npmrc.Open
+	}
+	nrc, err := open(path, opts.scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open .npmrc file: %w", err)
+	}
+	return nrc, nil
+}
+
+// openApt opens the apt auth config file of the name, which locks it unless
+// unlocked.
+func openApt(configName string, opts openOptions) (previewableConfig, error) {
+	open := apt.OpenLocked
+	if opts.unlocked {
+		open = apt.Open
+	}
+	cfg, err := open(configName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open apt auth config file: %w", err)
+	}
+	cfg.SetMerge(opts.merge)
+	return cfg, nil
+}
+
+// openGradle opens the gradle.properties file at path, which locks it unless
+// unlocked.
+func openGradle(path string, opts openOptions) (previewableConfig, error) {
+	open := gradle.OpenLocked
+	if opts.unlocked {
+		open = gradle.Open
+	}
+	props, err := open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gradle.properties file: %w", err)
+	}
+	return props, nil
+}
+
+// openPip opens the pip.conf file at path, which locks it unless unlocked.
+func openPip(path string, opts openOptions) (previewableConfig, error) {
+	open := pip.OpenLocked
+	if opts.unlocked {
+		open = pip.Open
+	}
+	conf, err := open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pip.conf file: %w", err)
+	}
+	return conf, nil
+}
+
+// openPyPIRC opens the .pypirc file at path, which locks it unless unlocked.
+func openPyPIRC(path string, opts openOptions) (previewableConfig, error) {
+	open := pypirc.OpenLocked
+	if opts.unlocked {
+		open = pypirc.Open
+	}
+	cfg, err := open(path, opts.repoIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open .pypirc file: %w", err)
+	}
+	return cfg, nil
+}
+
+// openDocker opens the Docker config.json file at path, which locks it unless
+// unlocked.
+func openDocker(path string, opts openOptions) (previewableConfig, error) {
+	open := docker.OpenLocked
+	if opts.unlocked {
+		open = docker.Open
+	}
+	cfg, err := open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Docker config.json file: %w", err)
+	}
+	return cfg, nil
+}
+
 var rootCmd = func() cli.Command {
 	return &cli.RootCommand{
 		Name:    "artifact-registry-cred-helper",
 		Version: "dev",
 		Commands: map[string]cli.CommandFactory{
 			"get": func() cli.Command {
-				return &GetCommand{baseCommand: baseCommand{getAuthToken: defaultAuthTokenGetter, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+				return &GetCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"docker-credential": func() cli.Command {
+				return &DockerCredentialCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"git-credential": func() cli.Command {
+				return &GitCredentialCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
 			},
 			"set-netrc": func() cli.Command {
-				return &SetNetRCCommand{baseCommand: baseCommand{getAuthToken: defaultAuthTokenGetter, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+				return &SetNetRCCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
 			},
 			"set-maven": func() cli.Command {
-				return &SetMavenCommand{baseCommand: baseCommand{getAuthToken: defaultAuthTokenGetter, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+				return &SetMavenCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"set-docker": func() cli.Command {
+				return &SetDockerCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"set-gradle": func() cli.Command {
+				return &SetGradleCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
 			},
 			"set-apt": func() cli.Command {
-				return &SetAptCommand{baseCommand: baseCommand{getAuthToken: defaultAuthTokenGetter, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+				return &SetAptCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
 			},
 			"set-npm": func() cli.Command {
-				return &SetNPMCommand{baseCommand: baseCommand{getAuthToken: defaultAuthTokenGetter, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+				return &SetNPMCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"set-pip": func() cli.Command {
+				return &SetPipCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"set-pypirc": func() cli.Command {
+				return &SetPyPIRCCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"apply": func() cli.Command {
+				return &ApplyCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"daemon": func() cli.Command {
+				return &DaemonCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"doctor": func() cli.Command {
+				return &DoctorCommand{baseCommand: baseCommand{tokenProvider: defaultTokenProvider, getEncodedJSONKey: defaultEncodedJSONKeyGetter}}
+			},
+			"status": func() cli.Command {
+				return &StatusCommand{}
 			},
 		},
 	}
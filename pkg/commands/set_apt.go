@@ -3,18 +3,17 @@ package commands
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/abcxyz/pkg/cli"
-	"github.com/yolocs/artifact-registry-cred-helper/pkg/apt"
 )
 
 type SetAptCommand struct {
 	baseCommand
 
-	commonFlags *CommonFlags
-	configName  string
+	commonFlags  *CommonFlags
+	netrcOptions netrcOptions
+	configName   string
 }
 
 func (c *SetAptCommand) Desc() string {
@@ -28,13 +27,17 @@ Usage: {{ COMMAND }} [options]
 This command MUST be run in 'sudo -E' mode.
 
 Set the credential in /etc/apt/auth.conf.d for the given repos.
-All Artifact Registry credentials will be removed from the auth config before setting the new hosts.
+All Artifact Registry credentials will be removed from the auth config before setting the new hosts,
+unless --merge is set.
 
   # Example: Set the credential in the default path /etc/apt/auth.conf.d/artifact-registry.conf
   artifact-registry-cred-helper set-apt --repo-urls us-apt.pkg.dev/my-project/repo1
 
   # Example: Override the default auth config path.
   artifact-registry-cred-helper set-apt --repo-urls us-apt.pkg.dev/my-project/repo1 --config-name my-repo.conf
+
+  # Example: Rotate the access tokens already in the auth config
+  artifact-registry-cred-helper set-apt --refresh-only
 `
 }
 
@@ -50,6 +53,7 @@ func (c *SetAptCommand) Flags() *cli.FlagSet {
 		EnvVar:  "AR_CRED_HELPER_APT_AUTH_CONFIG",
 		Default: "artifact-registry.conf",
 	})
+	c.netrcOptions.addFlags(sec)
 
 	return set
 }
@@ -59,77 +63,36 @@ func (c *SetAptCommand) Run(ctx context.Context, args []string) (err error) {
 	if err := f.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
-	if err := c.commonFlags.validate(); err != nil {
+	if err := c.netrcOptions.validate(c.commonFlags); err != nil {
 		return err
 	}
 
-	cfg, err := apt.Open(c.configName)
-	if err != nil {
-		return fmt.Errorf("failed to open apt auth config file: %w", err)
+	open := func() (previewableConfig, error) {
+		return openApt(c.configName, openOptions{merge: c.netrcOptions.merge, unlocked: c.commonFlags.dryRun})
 	}
 
 	// Immediately run once.
-	if err := c.runOnce(ctx, cfg); err != nil {
+	expiry, err := c.runOnce(ctx, open, c.commonFlags.remove)
+	if err != nil {
 		return fmt.Errorf("failed to set credential: %w", err)
 	}
 
 	// Start background refresh if enabled.
-	if c.commonFlags.backgroundRefreshInterval > 0 {
-		ctx, cancel := context.WithTimeout(ctx, c.commonFlags.backgroundRefreshDuration)
-		defer cancel()
-		ticker := time.NewTicker(c.commonFlags.backgroundRefreshInterval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				if err := c.runOnce(ctx, cfg); err != nil {
-					return fmt.Errorf("failed to refresh credential: %w", err)
-				}
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-	}
-
-	return nil
+	return c.commonFlags.refresh(ctx, expiry, func(ctx context.Context, remove bool) (time.Time, error) {
+		return c.runOnce(ctx, open, remove)
+	})
 }
 
-func (c *SetAptCommand) runOnce(ctx context.Context, cfg authConfig) (err error) {
-	defer func() {
-		if closeErr := cfg.Close(); err == nil {
-			err = closeErr
-		}
-	}()
+func (c *SetAptCommand) runOnce(ctx context.Context, open func() (previewableConfig, error), remove bool) (time.Time, error) {
+	if c.netrcOptions.refreshOnly {
+		return c.refreshTokens(ctx, c.commonFlags, open)
+	}
 
 	hosts, err := c.commonFlags.repoHosts()
 	if err != nil {
 		// No error is possible here because we have validated the flag.
-		return err
-	}
-
-	if c.commonFlags.jsonKeyPath != "" {
-		k, err := c.getEncodedJSONKey(c.commonFlags.jsonKeyPath)
-		if err != nil {
-			return fmt.Errorf("failed to encode JSON key: %w", err)
-		}
-		cfg.SetJSONKey(hosts, k)
-		return nil
-	}
-
-	if c.commonFlags.accessTokenFromEnv != "" {
-		token := os.Getenv(c.commonFlags.accessTokenFromEnv)
-		if token == "" {
-			return fmt.Errorf("failed to get access token from env var %q", c.commonFlags.accessTokenFromEnv)
-		}
-		cfg.SetToken(hosts, token)
-		return nil
-	}
-
-	token, err := c.getAuthToken(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
+		return time.Time{}, err
 	}
-	cfg.SetToken(hosts, token)
 
-	return nil
+	return c.setCredential(ctx, c.commonFlags, open, hosts, remove)
 }
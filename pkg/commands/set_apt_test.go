@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
 )
 
 // Disable parallel due to setting env vars.
@@ -19,13 +20,23 @@ func TestSetAptCommand_runOnce(t *testing.T) {
 		wantErr     string
 		setEnv      map[string]string
 	}{
+		{
+			name: "refresh only",
+			command: &SetAptCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags:  &CommonFlags{},
+				netrcOptions: netrcOptions{refreshOnly: true},
+			},
+			mockAuth:  &mockAuthConfig{},
+			wantToken: "test-token",
+		},
 		{
 			name: "get auth token success",
 			command: &SetAptCommand{
 				baseCommand: baseCommand{
-					getAuthToken: func(context.Context) (string, error) {
-						return "test-token", nil
-					},
+					tokenProvider: auth.Static{Value: "test-token"},
 				},
 				commonFlags: &CommonFlags{
 					repoURLs: []string{"us-apt.pkg.dev/proj/repo"},
@@ -86,7 +97,7 @@ func TestSetAptCommand_runOnce(t *testing.T) {
 				t.Setenv(k, v)
 			}
 
-			err := tc.command.runOnce(context.Background(), tc.mockAuth)
+			_, err := tc.command.runOnce(context.Background(), tc.mockAuth.open, tc.command.commonFlags.remove)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Errorf("runOnce() error = %v, wantErr %v\n%s", err, tc.wantErr, diff)
 				return
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/docker"
+)
+
+type SetDockerCommand struct {
+	baseCommand
+
+	commonFlags      *CommonFlags
+	dockerConfigPath string
+	staticAuths      bool
+}
+
+func (c *SetDockerCommand) Desc() string {
+	return "Set the credential in the Docker config.json file for the given repos."
+}
+
+func (c *SetDockerCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+Set the credential in the Docker config.json file for the given repos.
+By default, the 'artifact-registry' credential helper is registered in
+'credHelpers' for the repo hosts, which requires this binary to be available as
+'docker-credential-artifact-registry' in PATH. See the docker-credential command.
+
+Where a credential helper cannot run, use --static-auths to write the
+credential into 'auths' instead. Other entries in the file are left untouched.
+
+  # Example: Register the credential helper in the default path ~/.docker/config.json
+  artifact-registry-cred-helper set-docker --repo-urls us-docker.pkg.dev/my-project/repo1
+
+  # Example: Override the default config.json path
+  artifact-registry-cred-helper set-docker --repo-urls us-docker.pkg.dev/my-project/repo1 --docker-config /home/user/.docker/config.json
+
+  # Example: Write static credential and refresh it in the background
+  artifact-registry-cred-helper set-docker --repo-urls us-docker.pkg.dev/my-project/repo1 --static-auths --background-refresh-interval 5m
+`
+}
+
+func (c *SetDockerCommand) Flags() *cli.FlagSet {
+	c.commonFlags = &CommonFlags{}
+	set := c.commonFlags.setSection(c.NewFlagSet())
+
+	sec := set.NewSection("DOCKER OPTIONS")
+	sec.StringVar(&cli.StringVar{
+		Name:   "docker-config",
+		Usage:  "The path to the Docker config.json file. Default to $DOCKER_CONFIG/config.json or ~/.docker/config.json.",
+		Target: &c.dockerConfigPath,
+		EnvVar: "AR_CRED_HELPER_DOCKER_CONFIG",
+	})
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "static-auths",
+		Usage:  "Write the credential into 'auths' instead of registering the credential helper.",
+		Target: &c.staticAuths,
+		EnvVar: "AR_CRED_HELPER_DOCKER_STATIC_AUTHS",
+	})
+
+	return set
+}
+
+func (c *SetDockerCommand) Run(ctx context.Context, args []string) (err error) {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if err := c.commonFlags.validate(); err != nil {
+		return err
+	}
+	hosts, err := c.commonFlags.repoHosts()
+	if err != nil {
+		return err
+	}
+	if err := validateDockerHosts(hosts); err != nil {
+		return err
+	}
+
+	open := func() (previewableConfig, error) {
+		return openDocker(c.dockerConfigPath, openOptions{unlocked: c.commonFlags.dryRun})
+	}
+
+	// Removal covers both the credential helpers and the static auths.
+	if !c.staticAuths && !c.commonFlags.remove {
+		if c.commonFlags.jsonKeyPath != "" || c.commonFlags.accessTokenFromEnv != "" ||
+			c.commonFlags.credentialConfig != "" || len(c.commonFlags.impersonateServiceAccount) > 0 || c.commonFlags.downscope {
+			return fmt.Errorf("--json-key, --access-token-from-env, --credential-config, --impersonate-service-account and --downscope require --static-auths")
+		}
+		// The credential helper gets a fresh credential on every pull.
+		if c.commonFlags.backgroundRefreshInterval > 0 || c.commonFlags.cleanupOnExit {
+			return fmt.Errorf("--background-refresh-interval and --cleanup-on-exit require --static-auths")
+		}
+		if err := c.update(c.commonFlags, open, func(cfg authConfig) error {
+			h, ok := unwrapConfig(cfg).(credHelperSetter)
+			if !ok {
+				return fmt.Errorf("the config doesn't support credential helpers")
+			}
+			h.SetCredHelper(hosts, docker.HelperName)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to set credential helper: %w", err)
+		}
+		return nil
+	}
+
+	// Immediately run once.
+	expiry, err := c.runOnce(ctx, open, c.commonFlags.remove)
+	if err != nil {
+		return fmt.Errorf("failed to set credential: %w", err)
+	}
+
+	// Start background refresh if enabled.
+	return c.commonFlags.refresh(ctx, expiry, func(ctx context.Context, remove bool) (time.Time, error) {
+		return c.runOnce(ctx, open, remove)
+	})
+}
+
+func (c *SetDockerCommand) runOnce(ctx context.Context, open func() (previewableConfig, error), remove bool) (time.Time, error) {
+	hosts, err := c.commonFlags.repoHosts()
+	if err != nil {
+		// No error is possible here because we have validated the flag.
+		return time.Time{}, err
+	}
+
+	return c.setCredential(ctx, c.commonFlags, open, hosts, remove)
+}
+
+// validateDockerHosts validates that the hosts are of Docker repos, i.e. in
+// format '[location]-docker.pkg.dev'.
+func validateDockerHosts(hosts []string) error {
+	var merr error
+	for _, h := range hosts {
+		if format, err := repoFormat(h); err != nil || format != "docker" {
+			merr = errors.Join(merr, fmt.Errorf("host %q not in format '[location]-docker.pkg.dev'", h))
+		}
+	}
+	return merr
+}
+
+// credHelperSetter is implemented by configs that can register credential
+// helpers.
+type credHelperSetter interface {
+	SetCredHelper(hosts []string, helper string)
+}
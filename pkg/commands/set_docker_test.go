@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+func TestSetDockerCommand_runOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     *SetDockerCommand
+		mockAuth    *mockAuthConfig
+		wantToken   string
+		wantJSONKey string
+		wantHosts   []string
+		wantErr     string
+		setEnv      map[string]string
+	}{
+		{
+			name: "get auth token success",
+			command: &SetDockerCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs: []string{"us-docker.pkg.dev/proj/repo"},
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			wantToken: "test-token",
+			wantHosts: []string{"us-docker.pkg.dev"},
+		},
+		{
+			name: "get json key success",
+			command: &SetDockerCommand{
+				baseCommand: baseCommand{
+					getEncodedJSONKey: func(string) (string, error) {
+						return "encoded-key", nil
+					},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs:    []string{"us-docker.pkg.dev/proj/repo"},
+					jsonKeyPath: "/path/to/key.json",
+				},
+			},
+			mockAuth:    &mockAuthConfig{},
+			wantJSONKey: "encoded-key",
+			wantHosts:   []string{"us-docker.pkg.dev"},
+		},
+		{
+			name: "get token from env success",
+			command: &SetDockerCommand{
+				commonFlags: &CommonFlags{
+					repoURLs:           []string{"us-docker.pkg.dev/proj/repo"},
+					accessTokenFromEnv: "TEST_TOKEN",
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			setEnv:    map[string]string{"TEST_TOKEN": "env-token"},
+			wantToken: "env-token",
+			wantHosts: []string{"us-docker.pkg.dev"},
+		},
+		{
+			name: "get token from env failure - env not set",
+			command: &SetDockerCommand{
+				commonFlags: &CommonFlags{
+					repoURLs:           []string{"us-docker.pkg.dev/proj/repo"},
+					accessTokenFromEnv: "TEST_TOKEN",
+				},
+			},
+			mockAuth: &mockAuthConfig{},
+			wantErr:  `failed to get access token from env var "TEST_TOKEN"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.setEnv {
+				t.Setenv(k, v)
+			}
+			_, err := tc.command.runOnce(context.Background(), tc.mockAuth.open, tc.command.commonFlags.remove)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("runOnce() error = %v, wantErr %v", err, tc.wantErr)
+				return
+			}
+
+			if tc.wantErr == "" {
+				if tc.wantToken != tc.mockAuth.token {
+					t.Errorf("token = %v, want %v", tc.mockAuth.token, tc.wantToken)
+				}
+				if tc.wantJSONKey != tc.mockAuth.jsonKey {
+					t.Errorf("jsonKey = %v, want %v", tc.mockAuth.jsonKey, tc.wantJSONKey)
+				}
+				if len(tc.wantHosts) != len(tc.mockAuth.hosts) {
+					t.Errorf("hosts = %v, want %v", tc.mockAuth.hosts, tc.wantHosts)
+				}
+				if !tc.mockAuth.closed {
+					t.Error("config was not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestSetDockerCommand_Run_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "background refresh with credential helper",
+			args:    []string{"--repo-urls", "us-docker.pkg.dev/proj/repo", "--background-refresh-interval", "5m"},
+			wantErr: "--background-refresh-interval and --cleanup-on-exit require --static-auths",
+		},
+		{
+			name:    "cleanup on exit with credential helper",
+			args:    []string{"--repo-urls", "us-docker.pkg.dev/proj/repo", "--background-refresh-interval", "5m", "--cleanup-on-exit"},
+			wantErr: "--background-refresh-interval and --cleanup-on-exit require --static-auths",
+		},
+		{
+			name:    "non docker host",
+			args:    []string{"--repo-urls", "us-go.pkg.dev/proj/repo"},
+			wantErr: `host "us-go.pkg.dev" not in format '[location]-docker.pkg.dev'`,
+		},
+		{
+			name:    "non docker host with static auths",
+			args:    []string{"--repo-urls", "us-maven.pkg.dev/proj/repo", "--static-auths"},
+			wantErr: `host "us-maven.pkg.dev" not in format '[location]-docker.pkg.dev'`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "config.json")
+			cmd := &SetDockerCommand{baseCommand: baseCommand{tokenProvider: auth.Static{Value: "test-token"}}}
+			err := cmd.Run(context.Background(), append(tc.args, "--docker-config", p))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("Run() %s", diff)
+			}
+			if _, err := os.Stat(p); !os.IsNotExist(err) {
+				t.Errorf("config stat error = %v, want not exist", err)
+			}
+		})
+	}
+}
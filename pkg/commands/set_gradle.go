@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/gradle"
+)
+
+type SetGradleCommand struct {
+	baseCommand
+
+	commonFlags     *CommonFlags
+	gradleUserHome  string
+	repoIDsOverride []string
+	initScript      bool
+}
+
+func (c *SetGradleCommand) Desc() string {
+	return "Set the credential in the Gradle gradle.properties file for the given repos."
+}
+
+func (c *SetGradleCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+Set the credential in the Gradle gradle.properties file for the given repos as
+[repoId]Username and [repoId]Password properties, which is what Gradle looks up
+for a repository declared with 'credentials(PasswordCredentials)'.
+By default, we use repository ID in format: artifactregistry[ProjectId][RepoName]
+to be used in build.gradle, since Gradle only allows letters and digits.
+
+  # Example: Set the credential in the default path ~/.gradle/gradle.properties
+  # The repo ID will be artifactregistryMyProjectRepo1
+  artifact-registry-cred-helper set-gradle --repo-urls us-maven.pkg.dev/my-project/repo1
+
+  # Example: Also generate ~/.gradle/init.d/artifact-registry.gradle that
+  # declares the repositories for all projects.
+  artifact-registry-cred-helper set-gradle --repo-urls us-maven.pkg.dev/my-project/repo1 --init-script
+
+  # Example: Remove all Artifact Registry credentials and the init script.
+  # Removal deletes the whole init script, so it cannot be combined with
+  # --repo-urls or --repo-ids-override.
+  artifact-registry-cred-helper set-gradle --init-script --remove
+
+  # Example: Override the repo IDs.
+  # The repo ID will be myArtifactRegistry
+  artifact-registry-cred-helper set-gradle --repo-ids-override myArtifactRegistry
+`
+}
+
+func (c *SetGradleCommand) Flags() *cli.FlagSet {
+	c.commonFlags = &CommonFlags{}
+	set := c.commonFlags.setSection(c.NewFlagSet())
+
+	sec := set.NewSection("GRADLE OPTIONS")
+	sec.StringVar(&cli.StringVar{
+		Name:   "gradle-user-home",
+		Usage:  "The Gradle user home where gradle.properties is. Default to $GRADLE_USER_HOME or ~/.gradle.",
+		Target: &c.gradleUserHome,
+		EnvVar: "AR_CRED_HELPER_GRADLE_USER_HOME",
+	})
+	sec.StringSliceVar(&cli.StringSliceVar{
+		Name:    "repo-ids-override",
+		Usage:   "Override the repo IDs that are used in build.gradle. With --init-script, there must be one for each repo URL in the same order.",
+		Target:  &c.repoIDsOverride,
+		EnvVar:  "AR_CRED_HELPER_GRADLE_REPO_IDS_OVERRIDE",
+		Example: "myArtifactRegistry",
+	})
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "init-script",
+		Usage:  "Generate an init script under init.d of the Gradle user home that declares the repositories.",
+		Target: &c.initScript,
+		EnvVar: "AR_CRED_HELPER_GRADLE_INIT_SCRIPT",
+	})
+
+	return set
+}
+
+func (c *SetGradleCommand) Run(ctx context.Context, args []string) (err error) {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if len(c.repoIDsOverride) > 0 && !c.initScript {
+		if err := c.commonFlags.validateWithoutURLs(); err != nil {
+			return err
+		}
+	} else {
+		if err := c.commonFlags.validate(); err != nil {
+			return err
+		}
+	}
+
+	// The init script is generated as a whole, removing only some repos from it
+	// would silently drop the others.
+	if c.initScript && c.commonFlags.remove && (len(c.commonFlags.repoURLs) > 0 || len(c.repoIDsOverride) > 0) {
+		return fmt.Errorf("--init-script with --remove deletes the whole init script and cannot be used with --repo-urls or --repo-ids-override")
+	}
+
+	switch {
+	case c.initScript && c.commonFlags.dryRun:
+		// Keep stdout a clean diff.
+		fmt.Fprintln(c.Stderr(), "Skipped the init script with --dry-run.")
+	case c.initScript && c.commonFlags.remove:
+		if err := gradle.RemoveInitScript(c.gradleUserHome); err != nil {
+			return fmt.Errorf("failed to remove init script: %w", err)
+		}
+	case c.initScript:
+		if len(c.repoIDsOverride) > 0 && len(c.repoIDsOverride) != len(c.commonFlags.parsedURLs) {
+			return fmt.Errorf("--repo-ids-override must have the same number of entries as --repo-urls")
+		}
+		repos, err := c.commonFlags.repos()
+		if err != nil {
+			return err
+		}
+		repoIDs := c.repoIDs()
+		m := make(map[string]string, len(repos))
+		for i, r := range repos {
+			m[repoIDs[i]] = r
+		}
+		if err := gradle.WriteInitScript(c.gradleUserHome, m); err != nil {
+			return fmt.Errorf("failed to write init script: %w", err)
+		}
+	}
+
+	open := func() (previewableConfig, error) {
+		return openGradle(c.gradleUserHome, openOptions{unlocked: c.commonFlags.dryRun})
+	}
+
+	// Immediately run once.
+	expiry, err := c.runOnce(ctx, open, c.commonFlags.remove)
+	if err != nil {
+		return fmt.Errorf("failed to set credential: %w", err)
+	}
+
+	// Start background refresh if enabled.
+	return c.commonFlags.refresh(ctx, expiry, func(ctx context.Context, remove bool) (time.Time, error) {
+		return c.runOnce(ctx, open, remove)
+	})
+}
+
+func (c *SetGradleCommand) repoIDs() []string {
+	if len(c.repoIDsOverride) > 0 {
+		return c.repoIDsOverride
+	}
+	repoIDs := make([]string, 0, len(c.commonFlags.parsedURLs))
+	for _, u := range c.commonFlags.parsedURLs {
+		repoIDs = append(repoIDs, gradle.DefaultRepoID(u))
+	}
+	return repoIDs
+}
+
+func (c *SetGradleCommand) runOnce(ctx context.Context, open func() (previewableConfig, error), remove bool) (time.Time, error) {
+	return c.setCredential(ctx, c.commonFlags, open, c.repoIDs(), remove)
+}
@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/gradle"
+)
+
+func TestSetGradleCommand_runOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     *SetGradleCommand
+		mockAuth    *mockAuthConfig
+		wantToken   string
+		wantJSONKey string
+		wantRepoIDs []string
+		wantErr     string
+		setEnv      map[string]string
+	}{
+		{
+			name: "get auth token success",
+			command: &SetGradleCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags: &CommonFlags{
+					parsedURLs: []*url.URL{{Host: "us-maven.pkg.dev", Path: "/proj/repo"}},
+				},
+			},
+			mockAuth:    &mockAuthConfig{},
+			wantToken:   "test-token",
+			wantRepoIDs: []string{"artifactregistryProjRepo"},
+		},
+		{
+			name: "get json key success",
+			command: &SetGradleCommand{
+				baseCommand: baseCommand{
+					getEncodedJSONKey: func(string) (string, error) {
+						return "encoded-key", nil
+					},
+				},
+				commonFlags: &CommonFlags{
+					parsedURLs:  []*url.URL{{Host: "us-maven.pkg.dev", Path: "/proj/repo"}},
+					jsonKeyPath: "/path/to/key.json",
+				},
+			},
+			mockAuth:    &mockAuthConfig{},
+			wantJSONKey: "encoded-key",
+			wantRepoIDs: []string{"artifactregistryProjRepo"},
+		},
+		{
+			name: "get token from env success",
+			command: &SetGradleCommand{
+				commonFlags: &CommonFlags{
+					parsedURLs:         []*url.URL{{Host: "us-maven.pkg.dev", Path: "/proj/repo"}},
+					accessTokenFromEnv: "TEST_TOKEN",
+				},
+			},
+			mockAuth:    &mockAuthConfig{},
+			setEnv:      map[string]string{"TEST_TOKEN": "env-token"},
+			wantToken:   "env-token",
+			wantRepoIDs: []string{"artifactregistryProjRepo"},
+		},
+		{
+			name: "get token from env failure - env not set",
+			command: &SetGradleCommand{
+				commonFlags: &CommonFlags{
+					repoURLs:           []string{"us-maven.pkg.dev/proj/repo"},
+					accessTokenFromEnv: "TEST_TOKEN",
+				},
+			},
+			mockAuth: &mockAuthConfig{},
+			wantErr:  "failed to get access token from env var",
+		},
+		{
+			name: "override repo IDs success",
+			command: &SetGradleCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs: []string{"us-maven.pkg.dev/proj/repo"},
+				},
+				repoIDsOverride: []string{"customRepoID"},
+			},
+			mockAuth:    &mockAuthConfig{},
+			wantToken:   "test-token",
+			wantRepoIDs: []string{"customRepoID"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.setEnv {
+				t.Setenv(k, v)
+			}
+			_, err := tc.command.runOnce(context.Background(), tc.mockAuth.open, tc.command.commonFlags.remove)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("runOnce() error = %v, wantErr %v", err, tc.wantErr)
+				return
+			}
+
+			if tc.wantErr == "" {
+				if tc.wantToken != tc.mockAuth.token {
+					t.Errorf("token = %v, want %v", tc.mockAuth.token, tc.wantToken)
+				}
+				if tc.wantJSONKey != tc.mockAuth.jsonKey {
+					t.Errorf("jsonKey = %v, want %v", tc.mockAuth.jsonKey, tc.wantJSONKey)
+				}
+				if diff := cmp.Diff(tc.wantRepoIDs, tc.mockAuth.hosts); diff != "" {
+					t.Errorf("repoIDs (-want,+got):\n%s", diff)
+				}
+				if !tc.mockAuth.closed {
+					t.Error("config was not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestSetGradleCommand_Run_removeSomeReposFromInitScript(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	if err := gradle.WriteInitScript(home, map[string]string{
+		"repo1": "https://us-maven.pkg.dev/proj/repo1",
+		"repo2": "https://us-maven.pkg.dev/proj/repo2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	scriptPath := filepath.Join(home, "init.d", gradle.InitScriptName)
+	want, err := os.ReadFile(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &SetGradleCommand{}
+	err = cmd.Run(context.Background(), []string{
+		"--gradle-user-home", home,
+		"--init-script",
+		"--remove",
+		"--repo-urls", "us-maven.pkg.dev/proj/repo1",
+	})
+	if diff := testutil.DiffErrString(err, "deletes the whole init script"); diff != "" {
+		t.Error(diff)
+	}
+
+	got, err := os.ReadFile(scriptPath)
+	if err != nil {
+		t.Fatalf("init script is gone: %v", err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("init script (-want,+got):\n%s", diff)
+	}
+}
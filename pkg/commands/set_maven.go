@@ -3,7 +3,6 @@ package commands
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/abcxyz/pkg/cli"
@@ -81,44 +80,23 @@ func (c *SetMavenCommand) Run(ctx context.Context, args []string) (err error) {
 		}
 	}
 
-	settings, err := maven.Open(c.mavenSettingsPath)
-	if err != nil {
-		return fmt.Errorf("failed to open Maven settings.xml file: %w", err)
+	open := func() (previewableConfig, error) {
+		return openMaven(c.mavenSettingsPath, openOptions{unlocked: c.commonFlags.dryRun})
 	}
 
 	// Immediately run once.
-	if err := c.runOnce(ctx, settings); err != nil {
+	expiry, err := c.runOnce(ctx, open, c.commonFlags.remove)
+	if err != nil {
 		return fmt.Errorf("failed to set credential: %w", err)
 	}
 
 	// Start background refresh if enabled.
-	if c.commonFlags.backgroundRefreshInterval > 0 {
-		ctx, cancel := context.WithTimeout(ctx, c.commonFlags.backgroundRefreshDuration)
-		defer cancel()
-		ticker := time.NewTicker(c.commonFlags.backgroundRefreshInterval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C: // Run periodically
-				if err := c.runOnce(ctx, settings); err != nil {
-					return fmt.Errorf("failed to refresh credential: %w", err)
-				}
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-	}
-
-	return nil
+	return c.commonFlags.refresh(ctx, expiry, func(ctx context.Context, remove bool) (time.Time, error) {
+		return c.runOnce(ctx, open, remove)
+	})
 }
 
-func (c *SetMavenCommand) runOnce(ctx context.Context, settings authConfig) (err error) {
-	defer func() {
-		if closeErr := settings.Close(); err == nil {
-			err = closeErr
-		}
-	}()
-
+func (c *SetMavenCommand) runOnce(ctx context.Context, open func() (previewableConfig, error), remove bool) (time.Time, error) {
 	repoIDs := c.repoIDsOverride
 	if len(repoIDs) <= 0 {
 		for _, u := range c.commonFlags.parsedURLs {
@@ -126,29 +104,5 @@ func (c *SetMavenCommand) runOnce(ctx context.Context, settings authConfig) (err
 		}
 	}
 
-	if c.commonFlags.jsonKeyPath != "" {
-		k, err := c.getEncodedJSONKey(c.commonFlags.jsonKeyPath)
-		if err != nil {
-			return fmt.Errorf("failed to encode JSON key: %w", err)
-		}
-		settings.SetJSONKey(repoIDs, k)
-		return nil
-	}
-
-	if c.commonFlags.accessTokenFromEnv != "" {
-		token := os.Getenv(c.commonFlags.accessTokenFromEnv)
-		if token == "" {
-			return fmt.Errorf("failed to get access token from env var %q", c.commonFlags.accessTokenFromEnv)
-		}
-		settings.SetToken(repoIDs, token)
-		return nil
-	}
-
-	token, err := c.getAuthToken(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
-	}
-	settings.SetToken(repoIDs, token)
-
-	return nil
+	return c.setCredential(ctx, c.commonFlags, open, repoIDs, remove)
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
 )
 
 func TestSetMavenSettings_runOnce(t *testing.T) {
@@ -23,9 +24,7 @@ func TestSetMavenSettings_runOnce(t *testing.T) {
 			name: "get auth token success",
 			command: &SetMavenCommand{
 				baseCommand: baseCommand{
-					getAuthToken: func(context.Context) (string, error) {
-						return "test-token", nil
-					},
+					tokenProvider: auth.Static{Value: "test-token"},
 				},
 				commonFlags: &CommonFlags{
 					parsedURLs: []*url.URL{{Host: "us-maven.pkg.dev", Path: "/proj/repo"}},
@@ -80,9 +79,7 @@ func TestSetMavenSettings_runOnce(t *testing.T) {
 			name: "override repo IDs success",
 			command: &SetMavenCommand{
 				baseCommand: baseCommand{
-					getAuthToken: func(context.Context) (string, error) {
-						return "test-token", nil
-					},
+					tokenProvider: auth.Static{Value: "test-token"},
 				},
 				commonFlags: &CommonFlags{
 					repoURLs: []string{"us-maven.pkg.dev/proj/repo"},
@@ -100,7 +97,7 @@ func TestSetMavenSettings_runOnce(t *testing.T) {
 			for k, v := range tc.setEnv {
 				t.Setenv(k, v)
 			}
-			err := tc.command.runOnce(context.Background(), tc.mockAuth)
+			_, err := tc.command.runOnce(context.Background(), tc.mockAuth.open, tc.command.commonFlags.remove)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Errorf("runOnce() error = %v, wantErr %v", err, tc.wantErr)
 				return
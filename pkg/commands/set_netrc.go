@@ -2,19 +2,19 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/abcxyz/pkg/cli"
-	"github.com/yolocs/artifact-registry-cred-helper/pkg/netrc"
 )
 
 type SetNetRCCommand struct {
 	baseCommand
 
-	commonFlags *CommonFlags
-	netrcPath   string
+	commonFlags  *CommonFlags
+	netrcOptions netrcOptions
+	netrcPath    string
 }
 
 func (c *SetNetRCCommand) Desc() string {
@@ -26,13 +26,23 @@ func (c *SetNetRCCommand) Help() string {
 Usage: {{ COMMAND }} [options]
 
 Set the credential in the .netrc file for the given host(s).
-All Artifact Registry credentials will be removed from the .netrc file before setting the new hosts.
+All Artifact Registry credentials will be removed from the .netrc file before setting the new hosts,
+unless --merge is set.
 
   # Example: Set the credential in the default path ~/.netrc
   artifact-registry-cred-helper set-netrc --repo-urls us-go.pkg.dev/my-project/repo1
 
   # Example: Override the default .netrc path
   artifact-registry-cred-helper set-netrc --repo-urls us-go.pkg.dev/my-project/repo1 --netrc /home/user/.netrc
+
+  # Example: Keep the credentials of other Artifact Registry hosts
+  artifact-registry-cred-helper set-netrc --repo-urls us-go.pkg.dev/my-project/repo1 --merge
+
+  # Example: Rotate the access tokens already in the .netrc file
+  artifact-registry-cred-helper set-netrc --refresh-only
+
+  # Example: Remove all Artifact Registry credentials from the .netrc file
+  artifact-registry-cred-helper set-netrc --remove
 `
 }
 
@@ -47,6 +57,7 @@ func (c *SetNetRCCommand) Flags() *cli.FlagSet {
 		Target: &c.netrcPath,
 		EnvVar: "AR_CRED_HELPER_NETRC",
 	})
+	c.netrcOptions.addFlags(sec)
 
 	return set
 }
@@ -56,77 +67,114 @@ func (c *SetNetRCCommand) Run(ctx context.Context, args []string) (err error) {
 	if err := f.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
-	if err := c.commonFlags.validate(); err != nil {
+	if err := c.netrcOptions.validate(c.commonFlags); err != nil {
 		return err
 	}
 
-	nrc, err := netrc.Open(c.netrcPath)
-	if err != nil {
-		return fmt.Errorf("failed to open .netrc file: %w", err)
+	open := func() (previewableConfig, error) {
+		return openNetRC(c.netrcPath, openOptions{merge: c.netrcOptions.merge, unlocked: c.commonFlags.dryRun})
 	}
 
 	// Immediately run once.
-	if err := c.runOnce(ctx, nrc); err != nil {
+	expiry, err := c.runOnce(ctx, open, c.commonFlags.remove)
+	if err != nil {
 		return fmt.Errorf("failed to set credential: %w", err)
 	}
 
 	// Start background refresh if enabled.
-	if c.commonFlags.backgroundRefreshInterval > 0 {
-		ctx, cancel := context.WithTimeout(ctx, c.commonFlags.backgroundRefreshDuration)
-		defer cancel()
-		ticker := time.NewTicker(c.commonFlags.backgroundRefreshInterval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				if err := c.runOnce(ctx, nrc); err != nil {
-					return fmt.Errorf("failed to refresh credential: %w", err)
-				}
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-	}
-
-	return nil
+	return c.commonFlags.refresh(ctx, expiry, func(ctx context.Context, remove bool) (time.Time, error) {
+		return c.runOnce(ctx, open, remove)
+	})
 }
 
-func (c *SetNetRCCommand) runOnce(ctx context.Context, nrc authConfig) (err error) {
-	defer func() {
-		if closeErr := nrc.Close(); err == nil {
-			err = closeErr
-		}
-	}()
+func (c *SetNetRCCommand) runOnce(ctx context.Context, open func() (previewableConfig, error), remove bool) (time.Time, error) {
+	if c.netrcOptions.refreshOnly {
+		return c.refreshTokens(ctx, c.commonFlags, open)
+	}
 
 	hosts, err := c.commonFlags.repoHosts()
 	if err != nil {
 		// No error is possible here because we have validated the flag.
-		return err
+		return time.Time{}, err
 	}
 
-	if c.commonFlags.jsonKeyPath != "" {
-		k, err := c.getEncodedJSONKey(c.commonFlags.jsonKeyPath)
-		if err != nil {
-			return fmt.Errorf("failed to encode JSON key: %w", err)
-		}
-		nrc.SetJSONKey(hosts, k)
-		return nil
+	return c.setCredential(ctx, c.commonFlags, open, hosts, remove)
+}
+
+// netrcOptions are the options of the commands that write netrc files.
+type netrcOptions struct {
+	merge       bool
+	refreshOnly bool
+}
+
+func (o *netrcOptions) addFlags(sec *cli.FlagSection) {
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "merge",
+		Usage:  "Only replace the Artifact Registry credentials of the hosts in --repo-urls, and keep the others.",
+		Target: &o.merge,
+		EnvVar: "AR_CRED_HELPER_MERGE",
+	})
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "refresh-only",
+		Usage:  "Replace the access tokens of the oauth2accesstoken entries already in the file with a new one, and leave everything else as is. --repo-urls is not needed.",
+		Target: &o.refreshOnly,
+		EnvVar: "AR_CRED_HELPER_REFRESH_ONLY",
+	})
+}
+
+// validate validates the common flags along with the options. With
+// --refresh-only, the hosts come from the file instead of --repo-urls.
+func (o *netrcOptions) validate(f *CommonFlags) error {
+	if !o.refreshOnly {
+		return f.validate()
 	}
 
-	if c.commonFlags.accessTokenFromEnv != "" {
-		token := os.Getenv(c.commonFlags.accessTokenFromEnv)
-		if token == "" {
-			return fmt.Errorf("failed to get access token from env var %q", c.commonFlags.accessTokenFromEnv)
-		}
-		nrc.SetToken(hosts, token)
-		return nil
+	merr := f.validateWithoutURLs()
+	if len(f.repoURLs) > 0 {
+		merr = errors.Join(merr, fmt.Errorf("--refresh-only cannot be used with --repo-urls"))
+	}
+	if o.merge {
+		merr = errors.Join(merr, fmt.Errorf("--refresh-only cannot be used with --merge"))
+	}
+	if f.remove {
+		merr = errors.Join(merr, fmt.Errorf("--refresh-only cannot be used with --remove"))
+	}
+	if f.cleanupOnExit {
+		merr = errors.Join(merr, fmt.Errorf("--refresh-only cannot be used with --cleanup-on-exit"))
 	}
+	if f.jsonKeyPath != "" {
+		merr = errors.Join(merr, fmt.Errorf("--refresh-only cannot be used with --json-key"))
+	}
+	return merr
+}
 
-	token, err := c.getAuthToken(ctx)
+// tokenRefresher is implemented by configs that can replace the existing
+// access tokens in place.
+type tokenRefresher interface {
+	Refresh(token string)
+}
+
+// refreshTokens replaces the existing access tokens in the config file opened
+// with open with a new one.
+func (c *baseCommand) refreshTokens(ctx context.Context, f *CommonFlags, open func() (previewableConfig, error)) (time.Time, error) {
+	opts, err := f.tokenOptions()
 	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
+		return time.Time{}, err
+	}
+	token, err := c.token(ctx, opts)
+	if err != nil {
+		return time.Time{}, err
 	}
-	nrc.SetToken(hosts, token)
 
-	return nil
+	if err := c.update(f, open, func(cfg authConfig) error {
+		r, ok := unwrapConfig(cfg).(tokenRefresher)
+		if !ok {
+			return fmt.Errorf("the config doesn't support refreshing tokens only")
+		}
+		r.Refresh(token.Value)
+		return nil
+	}); err != nil {
+		return time.Time{}, err
+	}
+	return token.Expiry, nil
 }
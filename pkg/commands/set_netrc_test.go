@@ -2,19 +2,42 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
 )
 
 type mockAuthConfig struct {
-	token    string
-	jsonKey  string
-	hosts    []string
-	closed   bool
-	failWith error
+	token     string
+	jsonKey   string
+	hosts     []string
+	removed   bool
+	refreshed bool
+	opened    bool
+	closed    bool
+	failWith  error
 }
 
+func (m *mockAuthConfig) open() (previewableConfig, error) {
+	m.opened = true
+	return m, nil
+}
+
+func (m *mockAuthConfig) Path() string { return "mock" }
+
+func (m *mockAuthConfig) Original() []byte { return nil }
+
+func (m *mockAuthConfig) Marshal() ([]byte, error) { return nil, nil }
+
 func (m *mockAuthConfig) SetToken(hosts []string, token string) {
 	m.token = token
 	m.hosts = hosts
@@ -25,29 +48,119 @@ func (m *mockAuthConfig) SetJSONKey(hosts []string, key string) {
 	m.hosts = hosts
 }
 
+func (m *mockAuthConfig) Remove(hosts []string) {
+	m.removed = true
+	m.hosts = hosts
+}
+
+func (m *mockAuthConfig) Refresh(token string) {
+	m.refreshed = true
+	m.token = token
+}
+
 func (m *mockAuthConfig) Close() error {
 	m.closed = true
 	return m.failWith
 }
 
+// fakeCredentialConfig writes a credential configuration with a file-sourced
+// subject token and starts a Security Token Service stand-in that exchanges
+// it for "sts-token". The stand-in also downscopes "test-token" to
+// "downscoped-token" with an access boundary on repo us-west1 proj/repo.
+func fakeCredentialConfig(t *testing.T) (configPath, stsEndpoint string) {
+	t.Helper()
+
+	const wantOptions = `{"accessBoundary":{"accessBoundaryRules":[{"availableResource":"//artifactregistry.googleapis.com/projects/proj/locations/us-west1/repositories/repo","availablePermissions":["inRole:roles/artifactregistry.reader"]}]}}`
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.PostForm.Get("subject_token") == "subject-token":
+			fmt.Fprint(w, `{"access_token":"sts-token","token_type":"Bearer","expires_in":3600}`)
+		case r.PostForm.Get("subject_token") == "test-token" && r.PostForm.Get("options") == wantOptions:
+			fmt.Fprint(w, `{"access_token":"downscoped-token","token_type":"Bearer","expires_in":3600}`)
+		default:
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(sts.Close)
+
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("subject-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(map[string]any{
+		"type":               "external_account",
+		"audience":           "//iam.googleapis.com/test-audience",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":          "https://sts.invalid/v1/token",
+		"credential_source":  map[string]string{"file": tokenPath},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath = filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return configPath, sts.URL
+}
+
+// fakeIAMCredentials starts an IAM Credentials API stand-in that issues
+// "impersonated-token" for reader@proj.iam.gserviceaccount.com to callers with
+// "test-token".
+func fakeIAMCredentials(t *testing.T) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" ||
+			r.URL.Path != "/v1/projects/-/serviceAccounts/reader@proj.iam.gserviceaccount.com:generateAccessToken" {
+			http.Error(w, `{"error":{"code":403}}`, http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"accessToken":"impersonated-token","expireTime":"2025-01-02T03:04:05Z"}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
 func TestSetNetRCCommand_runOnce(t *testing.T) {
+	credentialConfig, stsEndpoint := fakeCredentialConfig(t)
+	iamCredentialsEndpoint := fakeIAMCredentials(t)
+
 	tests := []struct {
-		name        string
-		command     *SetNetRCCommand
-		mockAuth    *mockAuthConfig
-		wantToken   string
-		wantJSONKey string
-		wantHosts   []string
-		wantErr     string
-		setEnv      map[string]string
+		name          string
+		command       *SetNetRCCommand
+		mockAuth      *mockAuthConfig
+		wantToken     string
+		wantJSONKey   string
+		wantHosts     []string
+		wantRemoved   bool
+		wantRefreshed bool
+		wantErr       string
+		setEnv        map[string]string
 	}{
+		{
+			name: "refresh only",
+			command: &SetNetRCCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags:  &CommonFlags{},
+				netrcOptions: netrcOptions{refreshOnly: true},
+			},
+			mockAuth:      &mockAuthConfig{},
+			wantToken:     "test-token",
+			wantRefreshed: true,
+		},
 		{
 			name: "get auth token success",
 			command: &SetNetRCCommand{
 				baseCommand: baseCommand{
-					getAuthToken: func(context.Context) (string, error) {
-						return "test-token", nil
-					},
+					tokenProvider: auth.Static{Value: "test-token"},
 				},
 				commonFlags: &CommonFlags{
 					repoURLs: []string{"us-west1.pkg.dev/proj/repo"},
@@ -98,6 +211,89 @@ func TestSetNetRCCommand_runOnce(t *testing.T) {
 			mockAuth: &mockAuthConfig{},
 			wantErr:  `failed to get access token from env var "TEST_TOKEN"`,
 		},
+		{
+			name: "get token from credential config success",
+			command: &SetNetRCCommand{
+				commonFlags: &CommonFlags{
+					repoURLs:         []string{"us-west1.pkg.dev/proj/repo"},
+					credentialConfig: credentialConfig,
+					stsEndpoint:      stsEndpoint,
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			wantToken: "sts-token",
+			wantHosts: []string{"us-west1.pkg.dev"},
+		},
+		{
+			name: "impersonate service account success",
+			command: &SetNetRCCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs:                  []string{"us-west1.pkg.dev/proj/repo"},
+					impersonateServiceAccount: []string{"reader@proj.iam.gserviceaccount.com"},
+					iamCredentialsEndpoint:    iamCredentialsEndpoint,
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			wantToken: "impersonated-token",
+			wantHosts: []string{"us-west1.pkg.dev"},
+		},
+		{
+			name: "downscope success",
+			command: &SetNetRCCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs:             []string{"us-west1-go.pkg.dev/proj/repo"},
+					downscope:            true,
+					downscopeRole:        "reader",
+					downscopeSTSEndpoint: stsEndpoint,
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			wantToken: "downscoped-token",
+			wantHosts: []string{"us-west1-go.pkg.dev"},
+		},
+		{
+			name: "impersonate service account failure",
+			command: &SetNetRCCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs:                  []string{"us-west1.pkg.dev/proj/repo"},
+					impersonateServiceAccount: []string{"writer@proj.iam.gserviceaccount.com"},
+					iamCredentialsEndpoint:    iamCredentialsEndpoint,
+				},
+			},
+			mockAuth: &mockAuthConfig{},
+			wantErr:  "failed to get access token: Impersonate: failed to generate access token: 403 Forbidden",
+		},
+		{
+			name: "remove given hosts",
+			command: &SetNetRCCommand{
+				commonFlags: &CommonFlags{
+					repoURLs: []string{"us-west1.pkg.dev/proj/repo"},
+					remove:   true,
+				},
+			},
+			mockAuth:    &mockAuthConfig{},
+			wantHosts:   []string{"us-west1.pkg.dev"},
+			wantRemoved: true,
+		},
+		{
+			name: "remove all hosts",
+			command: &SetNetRCCommand{
+				commonFlags: &CommonFlags{
+					remove: true,
+				},
+			},
+			mockAuth:    &mockAuthConfig{},
+			wantRemoved: true,
+		},
 	}
 
 	for _, tc := range tests {
@@ -105,7 +301,7 @@ func TestSetNetRCCommand_runOnce(t *testing.T) {
 			for k, v := range tc.setEnv {
 				t.Setenv(k, v)
 			}
-			err := tc.command.runOnce(context.Background(), tc.mockAuth)
+			_, err := tc.command.runOnce(context.Background(), tc.mockAuth.open, tc.command.commonFlags.remove)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Errorf("runOnce() error = %v, wantErr %v", err, tc.wantErr)
 				return
@@ -121,6 +317,12 @@ func TestSetNetRCCommand_runOnce(t *testing.T) {
 				if len(tc.wantHosts) != len(tc.mockAuth.hosts) {
 					t.Errorf("hosts = %v, want %v", tc.mockAuth.hosts, tc.wantHosts)
 				}
+				if tc.wantRemoved != tc.mockAuth.removed {
+					t.Errorf("removed = %v, want %v", tc.mockAuth.removed, tc.wantRemoved)
+				}
+				if tc.wantRefreshed != tc.mockAuth.refreshed {
+					t.Errorf("refreshed = %v, want %v", tc.mockAuth.refreshed, tc.wantRefreshed)
+				}
 				if !tc.mockAuth.closed {
 					t.Error("config was not closed")
 				}
@@ -128,3 +330,203 @@ func TestSetNetRCCommand_runOnce(t *testing.T) {
 		})
 	}
 }
+
+func TestSetNetRCCommand_runOnce_tokenBeforeOpen(t *testing.T) {
+	t.Parallel()
+
+	// The config file is locked from open until close, which must not include
+	// waiting for the token.
+	mockAuth := &mockAuthConfig{}
+	cmd := &SetNetRCCommand{
+		baseCommand: baseCommand{tokenProvider: auth.TokenProviderFunc(func(ctx context.Context) (*auth.Token, error) {
+			if mockAuth.opened {
+				t.Error("token fetched after the config was opened")
+			}
+			return &auth.Token{Value: "test-token"}, nil
+		})},
+		commonFlags: &CommonFlags{repoURLs: []string{"us-go.pkg.dev/proj/repo"}},
+	}
+
+	if _, err := cmd.runOnce(context.Background(), mockAuth.open, false); err != nil {
+		t.Fatalf("runOnce() error = %v", err)
+	}
+	if mockAuth.token != "test-token" || !mockAuth.closed {
+		t.Errorf("runOnce() token = %q, closed = %v, want %q, true", mockAuth.token, mockAuth.closed, "test-token")
+	}
+}
+
+func TestSetNetRCCommand_Run_rereadsOnRefresh(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), ".netrc")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := &SetNetRCCommand{baseCommand: baseCommand{tokenProvider: auth.Static{Value: "test-token"}}}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run(ctx, []string{
+			"--repo-urls", "us-go.pkg.dev/proj/repo",
+			"--netrc", p,
+			"--background-refresh-interval", "5m",
+			"--cleanup-on-exit",
+		})
+	}()
+
+	// Wait for the first write.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := os.ReadFile(p)
+		if strings.Contains(string(b), "test-token") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("credential was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Another tool edits the file between refreshes.
+	external := "machine example.com\nlogin me\npassword secret\n"
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, append([]byte(external), b...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cleanup on exit must start from the edited file.
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("Run() got no error, want context canceled")
+	}
+
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != external {
+		t.Errorf("file = %q, want %q", got, external)
+	}
+}
+
+func TestNetrcOptions_validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options netrcOptions
+		flags   *CommonFlags
+		wantErr string
+	}{
+		{
+			name:    "merge",
+			options: netrcOptions{merge: true},
+			flags:   &CommonFlags{repoURLs: []string{"us-go.pkg.dev/proj/repo"}},
+		},
+		{
+			name:    "merge without repo urls",
+			options: netrcOptions{merge: true},
+			flags:   &CommonFlags{},
+			wantErr: "no host specified",
+		},
+		{
+			name:    "refresh only",
+			options: netrcOptions{refreshOnly: true},
+			flags:   &CommonFlags{backgroundRefreshInterval: 5 * time.Minute},
+		},
+		{
+			name:    "refresh only conflicts",
+			options: netrcOptions{refreshOnly: true, merge: true},
+			flags: &CommonFlags{
+				repoURLs:    []string{"us-go.pkg.dev/proj/repo"},
+				jsonKeyPath: "/path/to/key.json",
+				remove:      true,
+			},
+			wantErr: "--refresh-only cannot be used with --repo-urls\n" +
+				"--refresh-only cannot be used with --merge\n" +
+				"--refresh-only cannot be used with --remove\n" +
+				"--refresh-only cannot be used with --json-key",
+		},
+		{
+			name:    "refresh only with cleanup on exit",
+			options: netrcOptions{refreshOnly: true},
+			flags:   &CommonFlags{backgroundRefreshInterval: 5 * time.Minute, cleanupOnExit: true},
+			wantErr: "--refresh-only cannot be used with --cleanup-on-exit",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.options.validate(tc.flags)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("validate() unexpected error: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSetNetRCCommand_Run_mergeAndRefreshOnly(t *testing.T) {
+	t.Parallel()
+
+	const content = "machine example.com login me password secret\n" +
+		"machine us-python.pkg.dev login oauth2accesstoken password old-python\n" +
+		"machine us-go.pkg.dev login oauth2accesstoken password old-go\n" +
+		"machine us-npm.pkg.dev login _json_key_base64 password key\n"
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "merge",
+			args: []string{"--repo-urls", "us-go.pkg.dev/proj/repo", "--merge"},
+			want: "machine example.com login me password secret\n" +
+				"machine us-python.pkg.dev login oauth2accesstoken password old-python\n" +
+				"machine us-npm.pkg.dev login _json_key_base64 password key\n" +
+				"\nmachine us-go.pkg.dev\nlogin oauth2accesstoken\npassword new-token\n",
+		},
+		{
+			name: "replace all",
+			args: []string{"--repo-urls", "us-go.pkg.dev/proj/repo"},
+			want: "machine example.com login me password secret\n" +
+				"\nmachine us-go.pkg.dev\nlogin oauth2accesstoken\npassword new-token\n",
+		},
+		{
+			name: "refresh only",
+			args: []string{"--refresh-only"},
+			want: "machine example.com login me password secret\n" +
+				"machine us-python.pkg.dev login oauth2accesstoken password new-token\n" +
+				"machine us-go.pkg.dev login oauth2accesstoken password new-token\n" +
+				"machine us-npm.pkg.dev login _json_key_base64 password key\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), ".netrc")
+			if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := &SetNetRCCommand{baseCommand: baseCommand{tokenProvider: auth.Static{Value: "new-token"}}}
+			if err := cmd.Run(context.Background(), append(tc.args, "--netrc", p)); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			got, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("file = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -3,11 +3,9 @@ package commands
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/abcxyz/pkg/cli"
-	"github.com/yolocs/artifact-registry-cred-helper/pkg/npmrc"
 )
 
 type SetNPMCommand struct {
@@ -69,67 +67,22 @@ func (c *SetNPMCommand) Run(ctx context.Context, args []string) (err error) {
 		return err
 	}
 
-	nrc, err := npmrc.Open(c.npmrcPath, c.scope)
-	if err != nil {
-		return fmt.Errorf("failed to open .netrc file: %w", err)
+	open := func() (previewableConfig, error) {
+		return openNPM(c.npmrcPath, openOptions{scope: c.scope, unlocked: c.commonFlags.dryRun})
 	}
 
 	// Immediately run once.
-	if err := c.runOnce(ctx, nrc); err != nil {
+	expiry, err := c.runOnce(ctx, open, c.commonFlags.remove)
+	if err != nil {
 		return fmt.Errorf("failed to set credential: %w", err)
 	}
 
 	// Start background refresh if enabled.
-	if c.commonFlags.backgroundRefreshInterval > 0 {
-		ctx, cancel := context.WithTimeout(ctx, c.commonFlags.backgroundRefreshDuration)
-		defer cancel()
-		ticker := time.NewTicker(c.commonFlags.backgroundRefreshInterval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				if err := c.runOnce(ctx, nrc); err != nil {
-					return fmt.Errorf("failed to refresh credential: %w", err)
-				}
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-	}
-
-	return nil
+	return c.commonFlags.refresh(ctx, expiry, func(ctx context.Context, remove bool) (time.Time, error) {
+		return c.runOnce(ctx, open, remove)
+	})
 }
 
-func (c *SetNPMCommand) runOnce(ctx context.Context, config authConfig) (err error) {
-	defer func() {
-		if closeErr := config.Close(); err == nil {
-			err = closeErr
-		}
-	}()
-
-	if c.commonFlags.jsonKeyPath != "" {
-		k, err := c.getEncodedJSONKey(c.commonFlags.jsonKeyPath)
-		if err != nil {
-			return fmt.Errorf("failed to encode JSON key: %w", err)
-		}
-		config.SetJSONKey(c.commonFlags.repoURLs, k)
-		return nil
-	}
-
-	if c.commonFlags.accessTokenFromEnv != "" {
-		token := os.Getenv(c.commonFlags.accessTokenFromEnv)
-		if token == "" {
-			return fmt.Errorf("failed to get access token from env var %q", c.commonFlags.accessTokenFromEnv)
-		}
-		config.SetToken(c.commonFlags.repoURLs, token)
-		return nil
-	}
-
-	token, err := c.getAuthToken(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
-	}
-	config.SetToken(c.commonFlags.repoURLs, token)
-
-	return nil
+func (c *SetNPMCommand) runOnce(ctx context.Context, open func() (previewableConfig, error), remove bool) (time.Time, error) {
+	return c.setCredential(ctx, c.commonFlags, open, c.commonFlags.repoURLs, remove)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/abcxyz/pkg/testutil"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
 )
 
 func TestSetNPMCommand_runOnce(t *testing.T) {
@@ -63,9 +64,7 @@ func TestSetNPMCommand_runOnce(t *testing.T) {
 			name: "get auth token success",
 			command: &SetNPMCommand{
 				baseCommand: baseCommand{
-					getAuthToken: func(ctx context.Context) (string, error) {
-						return "auth-token", nil
-					},
+					tokenProvider: auth.Static{Value: "auth-token"},
 				},
 				commonFlags: &CommonFlags{
 					repoURLs: []string{"eu.pkg.dev/proj/repo"},
@@ -82,7 +81,7 @@ func TestSetNPMCommand_runOnce(t *testing.T) {
 			for k, v := range tc.setEnv {
 				t.Setenv(k, v)
 			}
-			err := tc.command.runOnce(context.Background(), tc.mockAuth)
+			_, err := tc.command.runOnce(context.Background(), tc.mockAuth.open, tc.command.commonFlags.remove)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Errorf("runOnce() error = %v, wantErr %v, diff: %s", err, tc.wantErr, diff)
 				return
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/pip"
+)
+
+type SetPipCommand struct {
+	baseCommand
+
+	commonFlags *CommonFlags
+	pipConfPath string
+	virtualenv  bool
+}
+
+func (c *SetPipCommand) Desc() string {
+	return "Set the credential in the pip.conf file for the given repos."
+}
+
+func (c *SetPipCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+Set the index-url and extra-index-url in the pip.conf file for the given repos,
+with the credential embedded in the URLs. The first repo becomes the index-url
+unless another index-url is already set, in which case all repos are added to
+extra-index-url. Other sections and entries are left untouched.
+
+  # Example: Set the credential in the default path ~/.config/pip/pip.conf
+  artifact-registry-cred-helper set-pip --repo-urls us-python.pkg.dev/my-project/repo1
+
+  # Example: Override the default pip.conf path
+  artifact-registry-cred-helper set-pip --repo-urls us-python.pkg.dev/my-project/repo1 --pip-conf /etc/pip.conf
+
+  # Example: Set the credential in the pip.conf of the active virtualenv
+  artifact-registry-cred-helper set-pip --repo-urls us-python.pkg.dev/my-project/repo1 --virtualenv
+`
+}
+
+func (c *SetPipCommand) Flags() *cli.FlagSet {
+	c.commonFlags = &CommonFlags{}
+	set := c.commonFlags.setSection(c.NewFlagSet())
+
+	sec := set.NewSection("PIP OPTIONS")
+	sec.StringVar(&cli.StringVar{
+		Name:   "pip-conf",
+		Usage:  "The path to the pip.conf file. Default to the per-user config file, e.g. ~/.config/pip/pip.conf.",
+		Target: &c.pipConfPath,
+		EnvVar: "AR_CRED_HELPER_PIP_CONF",
+	})
+	sec.BoolVar(&cli.BoolVar{
+		Name:   "virtualenv",
+		Usage:  "Use the pip.conf of the active virtualenv, i.e. $VIRTUAL_ENV/pip.conf.",
+		Target: &c.virtualenv,
+		EnvVar: "AR_CRED_HELPER_PIP_VIRTUALENV",
+	})
+
+	return set
+}
+
+func (c *SetPipCommand) Run(ctx context.Context, args []string) (err error) {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if err := c.commonFlags.validate(); err != nil {
+		return err
+	}
+
+	confPath := c.pipConfPath
+	if c.virtualenv {
+		if confPath != "" {
+			return fmt.Errorf("only one of --pip-conf or --virtualenv can be set")
+		}
+		venv := os.Getenv("VIRTUAL_ENV")
+		if venv == "" {
+			return fmt.Errorf("no active virtualenv, VIRTUAL_ENV is not set")
+		}
+		confPath = filepath.Join(venv, pip.FileName())
+	}
+
+	open := func() (previewableConfig, error) {
+		return openPip(confPath, openOptions{unlocked: c.commonFlags.dryRun})
+	}
+
+	// Immediately run once.
+	expiry, err := c.runOnce(ctx, open, c.commonFlags.remove)
+	if err != nil {
+		return fmt.Errorf("failed to set credential: %w", err)
+	}
+
+	// Start background refresh if enabled.
+	return c.commonFlags.refresh(ctx, expiry, func(ctx context.Context, remove bool) (time.Time, error) {
+		return c.runOnce(ctx, open, remove)
+	})
+}
+
+func (c *SetPipCommand) runOnce(ctx context.Context, open func() (previewableConfig, error), remove bool) (time.Time, error) {
+	repos, err := c.commonFlags.repos()
+	if err != nil {
+		// No error is possible here because we have validated the flag.
+		return time.Time{}, err
+	}
+
+	return c.setCredential(ctx, c.commonFlags, open, repos, remove)
+}
@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+func TestSetPipCommand_runOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     *SetPipCommand
+		mockAuth    *mockAuthConfig
+		wantToken   string
+		wantJSONKey string
+		wantRepos   []string
+		wantErr     string
+		setEnv      map[string]string
+	}{
+		{
+			name: "get auth token success",
+			command: &SetPipCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs: []string{"us-python.pkg.dev/proj/repo1", "https://us-python.pkg.dev/proj/repo2"},
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			wantToken: "test-token",
+			wantRepos: []string{"us-python.pkg.dev/proj/repo1", "us-python.pkg.dev/proj/repo2"},
+		},
+		{
+			name: "get json key success",
+			command: &SetPipCommand{
+				baseCommand: baseCommand{
+					getEncodedJSONKey: func(string) (string, error) {
+						return "encoded-key", nil
+					},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs:    []string{"us-python.pkg.dev/proj/repo"},
+					jsonKeyPath: "/path/to/key.json",
+				},
+			},
+			mockAuth:    &mockAuthConfig{},
+			wantJSONKey: "encoded-key",
+			wantRepos:   []string{"us-python.pkg.dev/proj/repo"},
+		},
+		{
+			name: "get token from env success",
+			command: &SetPipCommand{
+				commonFlags: &CommonFlags{
+					repoURLs:           []string{"us-python.pkg.dev/proj/repo"},
+					accessTokenFromEnv: "TEST_TOKEN",
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			setEnv:    map[string]string{"TEST_TOKEN": "env-token"},
+			wantToken: "env-token",
+			wantRepos: []string{"us-python.pkg.dev/proj/repo"},
+		},
+		{
+			name: "get token from env failure - env not set",
+			command: &SetPipCommand{
+				commonFlags: &CommonFlags{
+					repoURLs:           []string{"us-python.pkg.dev/proj/repo"},
+					accessTokenFromEnv: "TEST_TOKEN",
+				},
+			},
+			mockAuth: &mockAuthConfig{},
+			wantErr:  `failed to get access token from env var "TEST_TOKEN"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.setEnv {
+				t.Setenv(k, v)
+			}
+			_, err := tc.command.runOnce(context.Background(), tc.mockAuth.open, tc.command.commonFlags.remove)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("runOnce() error = %v, wantErr %v", err, tc.wantErr)
+				return
+			}
+
+			if tc.wantErr == "" {
+				if tc.wantToken != tc.mockAuth.token {
+					t.Errorf("token = %v, want %v", tc.mockAuth.token, tc.wantToken)
+				}
+				if tc.wantJSONKey != tc.mockAuth.jsonKey {
+					t.Errorf("jsonKey = %v, want %v", tc.mockAuth.jsonKey, tc.wantJSONKey)
+				}
+				if diff := cmp.Diff(tc.wantRepos, tc.mockAuth.hosts); diff != "" {
+					t.Errorf("repos (-want,+got):\n%s", diff)
+				}
+				if !tc.mockAuth.closed {
+					t.Error("config was not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestSetPipCommand_Run_rereadsOnRefresh(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "pip.conf")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := &SetPipCommand{baseCommand: baseCommand{tokenProvider: auth.Static{Value: "test-token"}}}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run(ctx, []string{
+			"--repo-urls", "us-python.pkg.dev/proj/repo",
+			"--pip-conf", p,
+			"--background-refresh-interval", "5m",
+			"--cleanup-on-exit",
+		})
+	}()
+
+	// Wait for the first write.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := os.ReadFile(p)
+		if strings.Contains(string(b), "test-token") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("credential was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Another tool edits the file between refreshes.
+	external := "[install]\ntrusted-host = example.com\n"
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, append(b, []byte(external)...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cleanup on exit must start from the edited file.
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("Run() got no error, want context canceled")
+	}
+
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), external) || strings.Contains(string(got), "test-token") {
+		t.Errorf("file = %q, want %q kept and the credential removed", got, external)
+	}
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+)
+
+type SetPyPIRCCommand struct {
+	baseCommand
+
+	commonFlags     *CommonFlags
+	pypircPath      string
+	repoIDsOverride []string
+}
+
+func (c *SetPyPIRCCommand) Desc() string {
+	return "Set the credential in the .pypirc file for the given repos."
+}
+
+func (c *SetPyPIRCCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+Set the credential in the .pypirc file for the given repos so that packages can
+be uploaded with twine. Each repo is added to the index-servers of the
+[distutils] section. Other index servers are left untouched.
+By default, we use index server name in format: artifactregistry-[project_id]-[repo_name].
+
+  # Example: Set the credential in the default path ~/.pypirc
+  # The index server name will be artifactregistry-my-project-repo1
+  artifact-registry-cred-helper set-pypirc --repo-urls us-python.pkg.dev/my-project/repo1
+  twine upload --repository artifactregistry-my-project-repo1 dist/*
+
+  # Example: Override the default .pypirc path
+  artifact-registry-cred-helper set-pypirc --repo-urls us-python.pkg.dev/my-project/repo1 --pypirc /home/user/.pypirc
+
+  # Example: Override the index server names, one for each repo URL.
+  artifact-registry-cred-helper set-pypirc --repo-urls us-python.pkg.dev/my-project/repo1 --repo-ids-override my-artifact-registry
+`
+}
+
+func (c *SetPyPIRCCommand) Flags() *cli.FlagSet {
+	c.commonFlags = &CommonFlags{}
+	set := c.commonFlags.setSection(c.NewFlagSet())
+
+	sec := set.NewSection("PYPIRC OPTIONS")
+	sec.StringVar(&cli.StringVar{
+		Name:   "pypirc",
+		Usage:  "The path to the .pypirc file. Default to ~/.pypirc.",
+		Target: &c.pypircPath,
+		EnvVar: "AR_CRED_HELPER_PYPIRC",
+	})
+	sec.StringSliceVar(&cli.StringSliceVar{
+		Name:    "repo-ids-override",
+		Usage:   "Override the index server names used with twine, one for each repo URL in the same order.",
+		Target:  &c.repoIDsOverride,
+		EnvVar:  "AR_CRED_HELPER_PYPIRC_REPO_IDS_OVERRIDE",
+		Example: "my-artifact-registry",
+	})
+
+	return set
+}
+
+func (c *SetPyPIRCCommand) Run(ctx context.Context, args []string) (err error) {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if err := c.commonFlags.validate(); err != nil {
+		return err
+	}
+
+	if len(c.repoIDsOverride) > 0 && len(c.repoIDsOverride) != len(c.commonFlags.parsedURLs) {
+		return fmt.Errorf("--repo-ids-override must have the same number of entries as --repo-urls")
+	}
+	repos, err := c.commonFlags.repos()
+	if err != nil {
+		return err
+	}
+	repoIDs := map[string]string{}
+	for i, id := range c.repoIDsOverride {
+		repoIDs[repos[i]] = id
+	}
+
+	open := func() (previewableConfig, error) {
+		return openPyPIRC(c.pypircPath, openOptions{repoIDs: repoIDs, unlocked: c.commonFlags.dryRun})
+	}
+
+	// Immediately run once.
+	expiry, err := c.runOnce(ctx, open, c.commonFlags.remove)
+	if err != nil {
+		return fmt.Errorf("failed to set credential: %w", err)
+	}
+
+	// Start background refresh if enabled.
+	return c.commonFlags.refresh(ctx, expiry, func(ctx context.Context, remove bool) (time.Time, error) {
+		return c.runOnce(ctx, open, remove)
+	})
+}
+
+func (c *SetPyPIRCCommand) runOnce(ctx context.Context, open func() (previewableConfig, error), remove bool) (time.Time, error) {
+	repos, err := c.commonFlags.repos()
+	if err != nil {
+		// No error is possible here because we have validated the flag.
+		return time.Time{}, err
+	}
+
+	return c.setCredential(ctx, c.commonFlags, open, repos, remove)
+}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+func TestSetPyPIRCCommand_runOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     *SetPyPIRCCommand
+		mockAuth    *mockAuthConfig
+		wantToken   string
+		wantJSONKey string
+		wantRepos   []string
+		wantErr     string
+		setEnv      map[string]string
+	}{
+		{
+			name: "get auth token success",
+			command: &SetPyPIRCCommand{
+				baseCommand: baseCommand{
+					tokenProvider: auth.Static{Value: "test-token"},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs: []string{"us-python.pkg.dev/proj/repo1", "https://us-python.pkg.dev/proj/repo2"},
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			wantToken: "test-token",
+			wantRepos: []string{"us-python.pkg.dev/proj/repo1", "us-python.pkg.dev/proj/repo2"},
+		},
+		{
+			name: "get json key success",
+			command: &SetPyPIRCCommand{
+				baseCommand: baseCommand{
+					getEncodedJSONKey: func(string) (string, error) {
+						return "encoded-key", nil
+					},
+				},
+				commonFlags: &CommonFlags{
+					repoURLs:    []string{"us-python.pkg.dev/proj/repo"},
+					jsonKeyPath: "/path/to/key.json",
+				},
+			},
+			mockAuth:    &mockAuthConfig{},
+			wantJSONKey: "encoded-key",
+			wantRepos:   []string{"us-python.pkg.dev/proj/repo"},
+		},
+		{
+			name: "get token from env success",
+			command: &SetPyPIRCCommand{
+				commonFlags: &CommonFlags{
+					repoURLs:           []string{"us-python.pkg.dev/proj/repo"},
+					accessTokenFromEnv: "TEST_TOKEN",
+				},
+			},
+			mockAuth:  &mockAuthConfig{},
+			setEnv:    map[string]string{"TEST_TOKEN": "env-token"},
+			wantToken: "env-token",
+			wantRepos: []string{"us-python.pkg.dev/proj/repo"},
+		},
+		{
+			name: "get token from env failure - env not set",
+			command: &SetPyPIRCCommand{
+				commonFlags: &CommonFlags{
+					repoURLs:           []string{"us-python.pkg.dev/proj/repo"},
+					accessTokenFromEnv: "TEST_TOKEN",
+				},
+			},
+			mockAuth: &mockAuthConfig{},
+			wantErr:  `failed to get access token from env var "TEST_TOKEN"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.setEnv {
+				t.Setenv(k, v)
+			}
+			_, err := tc.command.runOnce(context.Background(), tc.mockAuth.open, tc.command.commonFlags.remove)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("runOnce() error = %v, wantErr %v", err, tc.wantErr)
+				return
+			}
+
+			if tc.wantErr == "" {
+				if tc.wantToken != tc.mockAuth.token {
+					t.Errorf("token = %v, want %v", tc.mockAuth.token, tc.wantToken)
+				}
+				if tc.wantJSONKey != tc.mockAuth.jsonKey {
+					t.Errorf("jsonKey = %v, want %v", tc.mockAuth.jsonKey, tc.wantJSONKey)
+				}
+				if diff := cmp.Diff(tc.wantRepos, tc.mockAuth.hosts); diff != "" {
+					t.Errorf("repos (-want,+got):\n%s", diff)
+				}
+				if !tc.mockAuth.closed {
+					t.Error("config was not closed")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package commands
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/apt"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/maven"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/netrc"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/npmrc"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+type StatusCommand struct {
+	cli.BaseCommand
+
+	netrcPath         string
+	mavenSettingsPath string
+	npmrcPath         string
+	aptConfigName     string
+	tokenInfoEndpoint string
+	format            string
+}
+
+// credentialStatus is the status of an Artifact Registry credential in a
+// config file.
+type credentialStatus struct {
+	// File is the path of the config file.
+	File string `json:"file"`
+	// Entry is the host, repo ID or registry the credential is for.
+	Entry string `json:"entry,omitempty"`
+	// Type is the username, either oauth2accesstoken or _json_key_base64.
+	Type string `json:"type,omitempty"`
+	// Valid is whether the access token is valid, unknown for JSON keys.
+	Valid *bool `json:"valid,omitempty"`
+	// Email is the principal of the credential, if known.
+	Email string `json:"email,omitempty"`
+	// Expires is when the access token expires, in RFC 3339.
+	Expires string `json:"expires,omitempty"`
+	// Error is why the access token is invalid or the file can't be read.
+	Error string `json:"error,omitempty"`
+
+	secret string
+	expiry time.Time
+}
+
+func (c *StatusCommand) Desc() string {
+	return "Show the Artifact Registry credentials in config files and whether they are valid."
+}
+
+func (c *StatusCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+Show the Artifact Registry credentials in the .netrc, Maven settings.xml,
+.npmrc and apt auth config files, by default at the same paths as the set-*
+commands. Access tokens are checked against the tokeninfo endpoint for their
+remaining lifetime.
+
+  # Example: Show the credentials as a table
+  artifact-registry-cred-helper status
+
+  # Example: Show the credentials as JSON
+  artifact-registry-cred-helper status --format json
+`
+}
+
+func (c *StatusCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	sec := set.NewSection("OPTIONS")
+
+	sec.StringVar(&cli.StringVar{
+		Name:   "netrc",
+		Usage:  "The path to the .netrc file. Default to the system default path.",
+		Target: &c.netrcPath,
+		EnvVar: "AR_CRED_HELPER_NETRC",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:   "maven-settings",
+		Usage:  "The path to the Maven settings.xml file. Default to ~/.m2/settings.xml.",
+		Target: &c.mavenSettingsPath,
+		EnvVar: "AR_CRED_HELPER_MAVEN_SETTINGS",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:   "npmrc",
+		Usage:  "The path to the .npmrc file. Default to ~/.npmrc.",
+		Target: &c.npmrcPath,
+		EnvVar: "AR_CRED_HELPER_NPMRC",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "apt-config-name",
+		Usage:   "The name of the config file under /etc/apt/auth.conf.d",
+		Target:  &c.aptConfigName,
+		EnvVar:  "AR_CRED_HELPER_APT_AUTH_CONFIG",
+		Default: "artifact-registry.conf",
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "tokeninfo-endpoint",
+		Usage:   "Override the tokeninfo endpoint used to check access tokens.",
+		Target:  &c.tokenInfoEndpoint,
+		EnvVar:  "AR_CRED_HELPER_TOKENINFO_ENDPOINT",
+		Example: auth.DefaultTokenInfoEndpoint,
+	})
+
+	sec.StringVar(&cli.StringVar{
+		Name:    "format",
+		Usage:   "The output format, one of 'table' or 'json'.",
+		Target:  &c.format,
+		Default: formatTable,
+		EnvVar:  "AR_CRED_HELPER_STATUS_FORMAT",
+		Example: formatJSON,
+	})
+
+	return set
+}
+
+func (c *StatusCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	if c.format != formatTable && c.format != formatJSON {
+		return fmt.Errorf("unknown format %q, must be one of %q or %q", c.format, formatTable, formatJSON)
+	}
+
+	statuses := c.scan()
+	c.check(ctx, statuses)
+
+	if c.format == formatJSON {
+		if statuses == nil {
+			statuses = []*credentialStatus{}
+		}
+		b, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode status: %w", err)
+		}
+		if _, err := c.Stdout().Write(append(b, '\n')); err != nil {
+			return fmt.Errorf("failed to write status: %w", err)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.Stdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tENTRY\tTYPE\tSTATUS")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.File, orDash(s.Entry), orDash(s.Type), s.summary())
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write status: %w", err)
+	}
+	return nil
+}
+
+// scan lists the Artifact Registry credentials in the config files. Files
+// that can't be read are listed with the error.
+func (c *StatusCommand) scan() []*credentialStatus {
+	var statuses []*credentialStatus
+
+	if nrc, err := netrc.Open(c.netrcPath); err != nil {
+		statuses = append(statuses, &credentialStatus{File: orDefault(c.netrcPath, "~/.netrc"), Error: err.Error()})
+	} else {
+		for _, cred := range nrc.Credentials() {
+			statuses = append(statuses, newCredentialStatus(nrc.Path(), cred.Host, cred.Login, cred.Password))
+		}
+	}
+
+	if settings, err := maven.Open(c.mavenSettingsPath); err != nil {
+		statuses = append(statuses, &credentialStatus{File: orDefault(c.mavenSettingsPath, "~/.m2/settings.xml"), Error: err.Error()})
+	} else {
+		for _, cred := range settings.Credentials() {
+			statuses = append(statuses, newCredentialStatus(settings.Path(), cred.RepoID, cred.Username, cred.Password))
+		}
+	}
+
+	if cfg, err := npmrc.Open(c.npmrcPath, ""); err != nil {
+		statuses = append(statuses, &credentialStatus{File: orDefault(c.npmrcPath, "~/.npmrc"), Error: err.Error()})
+	} else {
+		for _, cred := range cfg.Credentials() {
+			statuses = append(statuses, newCredentialStatus(cfg.Path(), cred.Registry, cred.Username, cred.Password))
+		}
+	}
+
+	if cfg, err := apt.Open(c.aptConfigName); err != nil {
+		statuses = append(statuses, &credentialStatus{File: apt.ConfigPath(c.aptConfigName), Error: err.Error()})
+	} else {
+		for _, cred := range cfg.Credentials() {
+			statuses = append(statuses, newCredentialStatus(cfg.Path(), cred.Host, cred.Login, cred.Password))
+		}
+	}
+
+	return statuses
+}
+
+// check looks up the access tokens at the tokeninfo endpoint, once for each
+// distinct token.
+func (c *StatusCommand) check(ctx context.Context, statuses []*credentialStatus) {
+	type result struct {
+		info *auth.TokenInfo
+		err  error
+	}
+	results := map[string]result{}
+
+	for _, s := range statuses {
+		if s.Type != "oauth2accesstoken" {
+			continue
+		}
+		r, ok := results[s.secret]
+		if !ok {
+			r.info, r.err = auth.GetTokenInfo(ctx, nil, c.tokenInfoEndpoint, s.secret)
+			results[s.secret] = r
+		}
+
+		valid := r.err == nil
+		s.Valid = &valid
+		if r.err != nil {
+			s.Error = r.err.Error()
+			continue
+		}
+		s.Email = r.info.Email
+		s.expiry = r.info.Expiry
+		if !s.expiry.IsZero() {
+			s.Expires = s.expiry.UTC().Format(time.RFC3339)
+		}
+	}
+}
+
+func newCredentialStatus(file, entry, user, pwd string) *credentialStatus {
+	s := &credentialStatus{File: file, Entry: entry, Type: user, secret: pwd}
+	if user == "_json_key_base64" {
+		s.Email = jsonKeyEmail(pwd)
+	}
+	return s
+}
+
+// summary is the human readable status.
+func (s *credentialStatus) summary() string {
+	switch {
+	case s.Type == "":
+		return "error: " + s.Error
+	case s.Type == "_json_key_base64":
+		if s.Email != "" {
+			return "json key of " + s.Email
+		}
+		return "json key"
+	case s.Valid == nil || !*s.Valid:
+		return "invalid: " + s.Error
+	}
+
+	summary := "valid"
+	if !s.expiry.IsZero() {
+		summary += fmt.Sprintf(", expires in %s", time.Until(s.expiry).Round(time.Second))
+	}
+	if s.Email != "" {
+		summary += " (" + s.Email + ")"
+	}
+	return summary
+}
+
+// jsonKeyEmail returns the client_email of a base64 encoded JSON key, or empty
+// if it can't be decoded.
+func jsonKeyEmail(base64Key string) string {
+	b, err := base64.StdEncoding.DecodeString(base64Key)
+	if err != nil {
+		return ""
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+	}
+	if err := json.Unmarshal(b, &key); err != nil {
+		return ""
+	}
+	return key.ClientEmail
+}
+
+func orDash(s string) string {
+	return orDefault(s, "-")
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatusCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	tokenInfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("access_token") != "valid-token" {
+			http.Error(w, `{"error":"invalid_token"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"email":"me@example.com","exp":"%d"}`, exp.Unix())
+	}))
+	t.Cleanup(tokenInfo.Close)
+
+	dir := t.TempDir()
+	netrcPath := filepath.Join(dir, ".netrc")
+	jsonKey := base64.StdEncoding.EncodeToString([]byte(`{"client_email":"sa@proj.iam.gserviceaccount.com"}`))
+	if err := os.WriteFile(netrcPath, []byte(`machine example.com
+login me
+password secret
+
+machine us-go.pkg.dev
+login oauth2accesstoken
+password valid-token
+
+machine us-python.pkg.dev
+login _json_key_base64
+password `+jsonKey+`
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mavenPath := filepath.Join(dir, "settings.xml")
+	if err := os.WriteFile(mavenPath, []byte(`<settings>
+  <servers>
+    <server>
+      <id>artifactregistry-proj-repo</id>
+      <username>oauth2accesstoken</username>
+      <password>expired-token</password>
+    </server>
+    <server>
+      <id>other</id>
+      <username>me</username>
+      <password>secret</password>
+    </server>
+  </servers>
+</settings>
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	npmrcPath := filepath.Join(dir, ".npmrc")
+	if err := os.WriteFile(npmrcPath, []byte(`registry=https://us-npm.pkg.dev/proj/repo/
+//us-npm.pkg.dev/proj/repo/:_authToken=`+base64.StdEncoding.EncodeToString([]byte("oauth2accesstoken:valid-token"))+`
+//registry.npmjs.org/:_authToken=npm-token
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{
+		"--netrc", netrcPath,
+		"--maven-settings", mavenPath,
+		"--npmrc", npmrcPath,
+		"--apt-config-name", "does-not-exist-" + filepath.Base(dir) + ".conf",
+		"--tokeninfo-endpoint", tokenInfo.URL,
+	}
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		var stdout bytes.Buffer
+		cmd := &StatusCommand{}
+		cmd.SetStdout(&stdout)
+		if err := cmd.Run(context.Background(), append(args, "--format", "json")); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		var got []map[string]any
+		if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+			t.Fatalf("failed to unmarshal output %q: %v", stdout.String(), err)
+		}
+		want := []map[string]any{
+			{
+				"file":    netrcPath,
+				"entry":   "us-go.pkg.dev",
+				"type":    "oauth2accesstoken",
+				"valid":   true,
+				"email":   "me@example.com",
+				"expires": exp.UTC().Format(time.RFC3339),
+			},
+			{
+				"file":  netrcPath,
+				"entry": "us-python.pkg.dev",
+				"type":  "_json_key_base64",
+				"email": "sa@proj.iam.gserviceaccount.com",
+			},
+			{
+				"file":  mavenPath,
+				"entry": "artifactregistry-proj-repo",
+				"type":  "oauth2accesstoken",
+				"valid": false,
+				"error": `failed to get token info: 400 Bad Request: {"error":"invalid_token"}`,
+			},
+			{
+				"file":    npmrcPath,
+				"entry":   "//us-npm.pkg.dev/proj/repo/",
+				"type":    "oauth2accesstoken",
+				"valid":   true,
+				"email":   "me@example.com",
+				"expires": exp.UTC().Format(time.RFC3339),
+			},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Run() output (-want,+got):\n%s", diff)
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		t.Parallel()
+
+		var stdout bytes.Buffer
+		cmd := &StatusCommand{}
+		cmd.SetStdout(&stdout)
+		if err := cmd.Run(context.Background(), args); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		if got, want := len(lines), 5; got != want {
+			t.Fatalf("Run() output has %d lines, want %d:\n%s", got, want, stdout.String())
+		}
+		for i, want := range []string{
+			"STATUS",
+			"valid, expires in ",
+			"json key of sa@proj.iam.gserviceaccount.com",
+			"invalid: failed to get token info",
+			"(me@example.com)",
+		} {
+			if !strings.Contains(lines[i], want) {
+				t.Errorf("line %d = %q, want it to contain %q", i, lines[i], want)
+			}
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := &StatusCommand{}
+		err := cmd.Run(context.Background(), append(args, "--format", "yaml"))
+		if diff := testutil.DiffErrString(err, `unknown format "yaml"`); diff != "" {
+			t.Errorf("Run() unexpected error: %s", diff)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+// Client gets tokens from a daemon.
+type Client struct {
+	// SocketPath is the socket of the daemon. Default to DefaultSocketPath().
+	SocketPath string
+}
+
+// Token implements auth.TokenProvider.
+func (c *Client) Token(ctx context.Context) (*auth.Token, error) {
+	path := c.SocketPath
+	if path == "" {
+		path = DefaultSocketPath()
+	}
+
+	hc := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+	defer hc.CloseIdleConnections()
+
+	// The host is ignored since the connection is always to the socket.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://daemon"+tokenPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("daemon: failed to create request: %w", err)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("daemon: failed to connect to %q, is the daemon running? %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("daemon: failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("daemon: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	var v tokenResponse
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("daemon: failed to parse response: %w", err)
+	}
+	if v.Token == "" {
+		return nil, fmt.Errorf("daemon: empty access token")
+	}
+
+	tk := &auth.Token{Value: v.Token, Source: "daemon"}
+	if v.Source != "" {
+		tk.Source = "daemon/" + v.Source
+	}
+	if v.Expiry != "" {
+		expiry, err := time.Parse(time.RFC3339Nano, v.Expiry)
+		if err != nil {
+			return nil, fmt.Errorf("daemon: failed to parse token expiry %q: %w", v.Expiry, err)
+		}
+		tk.Expiry = expiry
+	}
+	return tk, nil
+}
@@ -0,0 +1,177 @@
+// Package daemon serves access tokens held in memory over a Unix domain
+// socket, so short-lived helper processes don't fetch a token each time.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+// tokenPath is the HTTP path the token is served at.
+const tokenPath = "/token"
+
+// tokenResponse is the JSON body of a token response.
+type tokenResponse struct {
+	Token string `json:"token"`
+	// Expiry is in RFC 3339 format, or empty if unknown.
+	Expiry string `json:"expiry,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// DefaultSocketPath returns the per-user socket path, in $XDG_RUNTIME_DIR if
+// set, or else in a per-user dir in the temp dir.
+func DefaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "artifact-registry-cred-helper", "daemon.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("artifact-registry-cred-helper-%d", os.Getuid()), "daemon.sock")
+}
+
+// Listen listens on the socket at path. The dir of the socket is created with
+// mode 0700 if missing, and must not be accessible by other users, and the
+// socket is only accessible by its owner. A socket left behind by a daemon
+// that is gone is replaced, but it's an error if a daemon is still serving it.
+func Listen(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create dir for %q: %w", path, err)
+	}
+	if err := checkDir(dir); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a daemon is already serving %q", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %q: %w", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %q: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict permissions of %q: %w", path, err)
+	}
+	return ln, nil
+}
+
+// checkDir makes sure only the current user can access the dir, since anyone
+// who can connect to the socket gets the token.
+func checkDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to stat %q: %w", dir, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%q is not a dir", dir)
+	}
+	if err := checkOwner(fi); err != nil {
+		return fmt.Errorf("%q: %w", dir, err)
+	}
+	if fi.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%q must not be accessible by other users, got mode %v", dir, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// Server serves the current token over HTTP.
+type Server struct {
+	mu    sync.RWMutex
+	token *auth.Token
+
+	now func() time.Time
+}
+
+// SetToken replaces the token being served.
+func (s *Server) SetToken(tk *auth.Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = tk
+}
+
+// ServeHTTP implements http.Handler. It responds with the token, or 503 if
+// there is none or it has expired.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != tokenPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	tk := s.token
+	s.mu.RUnlock()
+
+	if tk == nil {
+		http.Error(w, "no token yet", http.StatusServiceUnavailable)
+		return
+	}
+	if !tk.Expiry.IsZero() && !s.nowFunc().Before(tk.Expiry) {
+		http.Error(w, "token expired", http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := &tokenResponse{Token: tk.Value, Source: tk.Source}
+	if !tk.Expiry.IsZero() {
+		resp.Expiry = tk.Expiry.UTC().Format(time.RFC3339Nano)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// Serve serves on the listener until the context is done, and closes it.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) nowFunc() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
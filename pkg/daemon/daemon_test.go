@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/auth"
+)
+
+// socketPath returns a short socket path, since socket paths are limited to
+// about 100 bytes.
+func socketPath(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "arch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "run", "d.sock")
+}
+
+func TestServerAndClient(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	expiry := now.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		token   *auth.Token
+		want    *auth.Token
+		wantErr string
+	}{
+		{
+			name:  "token with expiry",
+			token: &auth.Token{Value: "test-token", Expiry: expiry, Source: "gcloud"},
+			want:  &auth.Token{Value: "test-token", Expiry: expiry, Source: "daemon/gcloud"},
+		},
+		{
+			name:  "token without expiry",
+			token: &auth.Token{Value: "test-token"},
+			want:  &auth.Token{Value: "test-token", Source: "daemon"},
+		},
+		{
+			name:    "expired token",
+			token:   &auth.Token{Value: "test-token", Expiry: now},
+			wantErr: "unexpected status 503: token expired",
+		},
+		{
+			name:    "no token",
+			wantErr: "unexpected status 503: no token yet",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := socketPath(t)
+			ln, err := Listen(path)
+			if err != nil {
+				t.Fatalf("Listen() error = %v", err)
+			}
+
+			s := &Server{now: func() time.Time { return now }}
+			if tc.token != nil {
+				s.SetToken(tc.token)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			served := make(chan error, 1)
+			go func() { served <- s.Serve(ctx, ln) }()
+			t.Cleanup(func() {
+				cancel()
+				if err := <-served; err != nil {
+					t.Errorf("Serve() error = %v", err)
+				}
+			})
+
+			got, err := (&Client{SocketPath: path}).Token(context.Background())
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatalf("Token() unexpected error: %s", diff)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Token() (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClient_noDaemon(t *testing.T) {
+	t.Parallel()
+
+	_, err := (&Client{SocketPath: socketPath(t)}).Token(context.Background())
+	if diff := testutil.DiffErrString(err, "is the daemon running?"); diff != "" {
+		t.Errorf("Token() unexpected error: %s", diff)
+	}
+}
+
+func TestListen(t *testing.T) {
+	t.Parallel()
+
+	path := socketPath(t)
+	ln, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		for p, want := range map[string]os.FileMode{filepath.Dir(path): 0o700, path: 0o600} {
+			fi, err := os.Stat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fi.Mode().Perm(); got != want {
+				t.Errorf("mode of %s = %v, want %v", p, got, want)
+			}
+		}
+	}
+
+	// Another daemon can't take over the socket while it's served.
+	if _, err := Listen(path); err == nil {
+		t.Errorf("Listen() got no error while the socket is served")
+	}
+
+	// A socket left behind is replaced.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatalf("stale socket is gone: %v", err)
+	}
+	ln, err = Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() with a stale socket error = %v", err)
+	}
+	ln.Close()
+}
+
+func TestListen_insecureDir(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+
+	path := socketPath(t)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Listen(path)
+	if diff := testutil.DiffErrString(err, "must not be accessible by other users"); diff != "" {
+		t.Errorf("Listen() unexpected error: %s", diff)
+	}
+}
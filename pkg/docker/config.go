@@ -0,0 +1,263 @@
+// Package docker provides functions to modify a Docker config.json file.
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/atomicfile"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/filelock"
+)
+
+// HelperName is the name of our Docker credential helper, i.e. the suffix of
+// the docker-credential-artifact-registry binary.
+const HelperName = "artifact-registry"
+
+// Config is a Docker config.json file. Only "credHelpers" and "auths" are
+// interpreted, all other fields are kept as is.
+type Config struct {
+	path     string
+	original []byte
+	raw      map[string]json.RawMessage
+
+	credHelpers map[string]string
+	auths       map[string]map[string]json.RawMessage
+
+	lock *filelock.Lock
+}
+
+// Open loads the Docker config file without locking it. If the path is empty,
+// it uses $DOCKER_CONFIG/config.json or ~/.docker/config.json. Use OpenLocked
+// to update the file.
+func Open(configPath string) (*Config, error) {
+	configPath, err := resolvePath(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return read(configPath)
+}
+
+// OpenLocked is like Open, but holds an exclusive lock on the file until
+// Close or Discard, so concurrent updates from other processes don't lose
+// each other's changes.
+func OpenLocked(configPath string) (*Config, error) {
+	configPath, err := resolvePath(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := filelock.Acquire(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %q: %w", configPath, err)
+	}
+	c, err := read(configPath)
+	if err != nil {
+		return nil, errors.Join(err, lock.Release())
+	}
+	c.lock = lock
+	return c, nil
+}
+
+func resolvePath(configPath string) (string, error) {
+	if configPath == "" {
+		configPath = os.Getenv("DOCKER_CONFIG")
+	}
+	if configPath == "" {
+		h, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot find HOME dir: %w", err)
+		}
+		configPath = filepath.Join(h, ".docker")
+	}
+	if !strings.HasSuffix(configPath, ".json") {
+		configPath = filepath.Join(configPath, "config.json")
+	}
+	return configPath, nil
+}
+
+func read(configPath string) (*Config, error) {
+	c := &Config{
+		path:        configPath,
+		raw:         map[string]json.RawMessage{},
+		credHelpers: map[string]string{},
+		auths:       map[string]map[string]json.RawMessage{},
+	}
+
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load file %q: %v", configPath, err)
+	}
+	c.original = data
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return c, nil
+	}
+
+	if err := json.Unmarshal(data, &c.raw); err != nil {
+		return nil, fmt.Errorf("failed to parse Docker config %q: %w", configPath, err)
+	}
+	if v, ok := c.raw["credHelpers"]; ok {
+		if err := json.Unmarshal(v, &c.credHelpers); err != nil {
+			return nil, fmt.Errorf("failed to parse credHelpers in %q: %w", configPath, err)
+		}
+	}
+	if v, ok := c.raw["auths"]; ok {
+		if err := json.Unmarshal(v, &c.auths); err != nil {
+			return nil, fmt.Errorf("failed to parse auths in %q: %w", configPath, err)
+		}
+	}
+	// Fields explicitly set to null.
+	if c.credHelpers == nil {
+		c.credHelpers = map[string]string{}
+	}
+	if c.auths == nil {
+		c.auths = map[string]map[string]json.RawMessage{}
+	}
+
+	return c, nil
+}
+
+// SetCredHelper registers the credential helper for the given hosts. Static
+// credentials of the hosts are removed so that the helper takes effect.
+func (c *Config) SetCredHelper(hosts []string, helper string) {
+	for _, h := range hosts {
+		c.credHelpers[h] = helper
+		delete(c.auths, h)
+	}
+}
+
+func (c *Config) SetToken(hosts []string, token string) {
+	c.update(hosts, "oauth2accesstoken", token)
+}
+
+func (c *Config) SetJSONKey(hosts []string, base64Key string) {
+	c.update(hosts, "_json_key_base64", base64Key)
+}
+
+// Close writes the file and releases the lock if any.
+func (c *Config) Close() (retErr error) {
+	defer func() {
+		retErr = errors.Join(retErr, c.Discard())
+	}()
+
+	b, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Make sure dir exists.
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create dir for %q: %w", c.path, err)
+	}
+
+	if err := atomicfile.Write(c.path, b); err != nil {
+		return fmt.Errorf("failed to save %q: %w", c.path, err)
+	}
+	return nil
+}
+
+// Discard releases the lock if any without writing the file.
+func (c *Config) Discard() error {
+	return c.lock.Release()
+}
+
+// Path returns the path of the config.json file.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Original returns the content of the file when opened.
+func (c *Config) Original() []byte {
+	return c.original
+}
+
+// Marshal returns the content of the config file.
+func (c *Config) Marshal() ([]byte, error) {
+	if err := setRaw(c.raw, "credHelpers", c.credHelpers); err != nil {
+		return nil, err
+	}
+	if err := setRaw(c.raw, "auths", c.auths); err != nil {
+		return nil, err
+	}
+
+	// Docker itself writes the config with tab indentation.
+	b, err := json.MarshalIndent(c.raw, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Docker config: %w", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// setRaw sets the field in the raw config. Empty fields are only kept if they
+// were in the file already.
+func setRaw[T any](raw map[string]json.RawMessage, key string, v map[string]T) error {
+	if _, ok := raw[key]; !ok && len(v) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	raw[key] = b
+	return nil
+}
+
+// Remove removes the credential helpers and static credentials of the given
+// hosts, or of all Artifact Registry hosts if no host is given. Other entries
+// are left intact.
+func (c *Config) Remove(hosts []string) {
+	set := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		set[h] = struct{}{}
+	}
+	matches := func(key string) bool {
+		// Keys of auths may have a scheme and path, e.g. https://index.docker.io/v1/.
+		h := key
+		if _, rest, ok := strings.Cut(h, "://"); ok {
+			h = rest
+		}
+		h, _, _ = strings.Cut(h, "/")
+		if len(hosts) == 0 {
+			return strings.HasSuffix(h, ".pkg.dev")
+		}
+		_, ok := set[h]
+		return ok
+	}
+
+	for h := range c.credHelpers {
+		if matches(h) {
+			delete(c.credHelpers, h)
+		}
+	}
+	for h := range c.auths {
+		if matches(h) {
+			delete(c.auths, h)
+		}
+	}
+}
+
+func (c *Config) update(hosts []string, user, pwd string) {
+	auth, _ := json.Marshal(base64.StdEncoding.EncodeToString([]byte(user + ":" + pwd)))
+	for _, h := range hosts {
+		entry := c.auths[h]
+		if entry == nil {
+			entry = map[string]json.RawMessage{}
+			c.auths[h] = entry
+		}
+		entry["auth"] = auth
+		// Stale fields would take precedence over "auth".
+		delete(entry, "username")
+		delete(entry, "password")
+		delete(entry, "identitytoken")
+
+		// A credential helper would take precedence over static credentials.
+		delete(c.credHelpers, h)
+	}
+}
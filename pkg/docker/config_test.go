@@ -0,0 +1,182 @@
+package docker
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const existingConfig = `{
+	"auths": {
+		"https://index.docker.io/v1/": {
+			"auth": "dXNlcjpwYXNz"
+		},
+		"us-docker.pkg.dev": {
+			"auth": "b2xkOm9sZA==",
+			"email": "me@example.com"
+		}
+	},
+	"credHelpers": {
+		"gcr.io": "gcloud"
+	},
+	"credsStore": "desktop",
+	"experimental": "enabled"
+}
+`
+
+func TestConfig_SetCredHelper(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(p, []byte(existingConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(p)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	c.SetCredHelper([]string{"us-docker.pkg.dev", "europe-docker.pkg.dev"}, HelperName)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+	"auths": {
+		"https://index.docker.io/v1/": {
+			"auth": "dXNlcjpwYXNz"
+		}
+	},
+	"credHelpers": {
+		"europe-docker.pkg.dev": "artifact-registry",
+		"gcr.io": "gcloud",
+		"us-docker.pkg.dev": "artifact-registry"
+	},
+	"credsStore": "desktop",
+	"experimental": "enabled"
+}
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Close() wrote (-want,+got):\n%s", diff)
+	}
+}
+
+func TestConfig_SetToken(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(p, []byte(existingConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(p)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	c.SetCredHelper([]string{"asia-docker.pkg.dev"}, HelperName)
+	c.SetToken([]string{"us-docker.pkg.dev", "asia-docker.pkg.dev"}, "token")
+
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("oauth2accesstoken:token"))
+	want := `{
+	"auths": {
+		"asia-docker.pkg.dev": {
+			"auth": "` + auth + `"
+		},
+		"https://index.docker.io/v1/": {
+			"auth": "dXNlcjpwYXNz"
+		},
+		"us-docker.pkg.dev": {
+			"auth": "` + auth + `",
+			"email": "me@example.com"
+		}
+	},
+	"credHelpers": {
+		"gcr.io": "gcloud"
+	},
+	"credsStore": "desktop",
+	"experimental": "enabled"
+}
+`
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Errorf("Marshal() (-want,+got):\n%s", diff)
+	}
+}
+
+func TestConfig_Remove(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(p, []byte(existingConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(p)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	c.SetCredHelper([]string{"europe-docker.pkg.dev"}, HelperName)
+	c.Remove(nil)
+
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{
+	"auths": {
+		"https://index.docker.io/v1/": {
+			"auth": "dXNlcjpwYXNz"
+		}
+	},
+	"credHelpers": {
+		"gcr.io": "gcloud"
+	},
+	"credsStore": "desktop",
+	"experimental": "enabled"
+}
+`
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Errorf("Marshal() (-want,+got):\n%s", diff)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	c, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if got, want := c.path, filepath.Join(dir, "config.json"); got != want {
+		t.Errorf("path = %q, want %q", got, want)
+	}
+
+	c.SetJSONKey([]string{"us-docker.pkg.dev"}, "key")
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("_json_key_base64:key"))
+	want := "{\n\t\"auths\": {\n\t\t\"us-docker.pkg.dev\": {\n\t\t\t\"auth\": \"" + auth + "\"\n\t\t}\n\t}\n}\n"
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Errorf("Marshal() (-want,+got):\n%s", diff)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(filepath.Join(dir, "bad.json")); err == nil {
+		t.Error("Open() expected error for malformed JSON")
+	}
+}
@@ -0,0 +1,400 @@
+// Package gradle provides functions to modify the Gradle user home, i.e. the
+// gradle.properties file and init scripts.
+package gradle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/atomicfile"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/filelock"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/maven"
+)
+
+// InitScriptName is the name of the init script we generate under init.d.
+const InitScriptName = "artifact-registry.gradle"
+
+// DefaultRepoID is our default way to construct the repository name used in
+// build.gradle, derived from maven.DefaultRepoID. Gradle only allows letters
+// and digits in the names of repositories with PasswordCredentials, so the
+// name is camel-cased.
+//
+// Given repo URL: us-maven.pkg.dev/my-project/my-repo
+// Default repo ID: artifactregistryMyProjectMyRepo
+func DefaultRepoID(repoURL *url.URL) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range maven.DefaultRepoID(repoURL) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// UserHome returns the Gradle user home, i.e. $GRADLE_USER_HOME or ~/.gradle.
+func UserHome() (string, error) {
+	if h := os.Getenv("GRADLE_USER_HOME"); h != "" {
+		return h, nil
+	}
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find HOME dir: %w", err)
+	}
+	return filepath.Join(h, ".gradle"), nil
+}
+
+// Properties is a gradle.properties file.
+type Properties struct {
+	path     string
+	original []byte
+	lines    []string
+	// crlf is whether the file uses CRLF line endings, which are kept when it
+	// is written back.
+	crlf bool
+	lock *filelock.Lock
+}
+
+// Open loads the gradle.properties file without locking it. The path could be
+// either the Gradle user home or the properties file. If empty, UserHome is
+// used. Use OpenLocked to update the file.
+func Open(propertiesPath string) (*Properties, error) {
+	propertiesPath, err := resolvePath(propertiesPath)
+	if err != nil {
+		return nil, err
+	}
+	return read(propertiesPath)
+}
+
+// OpenLocked is like Open, but holds an exclusive lock on the file until
+// Close or Discard, so concurrent updates from other processes don't lose
+// each other's changes.
+func OpenLocked(propertiesPath string) (*Properties, error) {
+	propertiesPath, err := resolvePath(propertiesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := filelock.Acquire(propertiesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %q: %w", propertiesPath, err)
+	}
+	p, err := read(propertiesPath)
+	if err != nil {
+		return nil, errors.Join(err, lock.Release())
+	}
+	p.lock = lock
+	return p, nil
+}
+
+func resolvePath(propertiesPath string) (string, error) {
+	if propertiesPath == "" {
+		h, err := UserHome()
+		if err != nil {
+			return "", err
+		}
+		propertiesPath = h
+	}
+	if !strings.HasSuffix(propertiesPath, ".properties") {
+		propertiesPath = filepath.Join(propertiesPath, "gradle.properties")
+	}
+	return propertiesPath, nil
+}
+
+func read(propertiesPath string) (*Properties, error) {
+	data, err := os.ReadFile(propertiesPath)
+	if os.IsNotExist(err) {
+		return &Properties{path: propertiesPath}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load file %q: %v", propertiesPath, err)
+	}
+
+	crlf := strings.Contains(string(data), "\r\n")
+	content := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if content == "" {
+		return &Properties{path: propertiesPath, original: data, crlf: crlf}, nil
+	}
+	return &Properties{path: propertiesPath, original: data, lines: strings.Split(content, "\n"), crlf: crlf}, nil
+}
+
+func (p *Properties) SetToken(repoIDs []string, token string) {
+	p.update(repoIDs, "oauth2accesstoken", token)
+}
+
+func (p *Properties) SetJSONKey(repoIDs []string, base64Key string) {
+	p.update(repoIDs, "_json_key_base64", base64Key)
+}
+
+// Close writes the file and releases the lock if any.
+func (p *Properties) Close() (retErr error) {
+	defer func() {
+		retErr = errors.Join(retErr, p.Discard())
+	}()
+
+	// Make sure dir exists.
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for %q: %w", p.path, err)
+	}
+
+	if err := atomicfile.Write(p.path, []byte(p.String())); err != nil {
+		return fmt.Errorf("failed to save %q: %w", p.path, err)
+	}
+	return nil
+}
+
+// Discard releases the lock if any without writing the file.
+func (p *Properties) Discard() error {
+	return p.lock.Release()
+}
+
+// Path returns the path of the gradle.properties file.
+func (p *Properties) Path() string {
+	return p.path
+}
+
+// Original returns the content of the file when opened.
+func (p *Properties) Original() []byte {
+	return p.original
+}
+
+// Marshal returns the content Close writes.
+func (p *Properties) Marshal() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// String returns the content of the properties file.
+func (p *Properties) String() string {
+	if len(p.lines) == 0 {
+		return ""
+	}
+	eol := "\n"
+	if p.crlf {
+		eol = "\r\n"
+	}
+	return strings.Join(p.lines, eol) + eol
+}
+
+func (p *Properties) update(repoIDs []string, user, pwd string) {
+	for _, id := range repoIDs {
+		p.set(id+"Username", user)
+		p.set(id+"Password", pwd)
+	}
+}
+
+// Remove removes the credential properties of the given repo IDs, or of all
+// repos with Artifact Registry credentials if no repo ID is given. Other
+// properties are left intact.
+func (p *Properties) Remove(repoIDs []string) {
+	if len(repoIDs) == 0 {
+		for i := 0; i < len(p.lines); i++ {
+			k, next := parseLine(p.lines, i)
+			if id, ok := strings.CutSuffix(k, "Username"); ok {
+				switch parseValue(p.lines[i], k) {
+				case "oauth2accesstoken", "_json_key_base64":
+					repoIDs = append(repoIDs, id)
+				}
+			}
+			i = next - 1
+		}
+	}
+
+	for _, id := range repoIDs {
+		p.remove(id + "Username")
+		p.remove(id + "Password")
+	}
+}
+
+// remove removes the property if it exists.
+func (p *Properties) remove(key string) {
+	for i := 0; i < len(p.lines); i++ {
+		k, next := parseLine(p.lines, i)
+		if k == key {
+			p.lines = append(p.lines[:i], p.lines[next:]...)
+			return
+		}
+		i = next - 1
+	}
+}
+
+// parseValue returns the value of a single line property with the given key.
+func parseValue(line, key string) string {
+	v := strings.TrimLeft(strings.TrimLeft(line, " \t\f")[len(key):], " \t\f")
+	if v != "" && (v[0] == '=' || v[0] == ':') {
+		v = strings.TrimLeft(v[1:], " \t\f")
+	}
+	return v
+}
+
+// set replaces the property in place or appends it to the end.
+func (p *Properties) set(key, value string) {
+	line := key + "=" + strings.ReplaceAll(value, `\`, `\\`)
+	for i := 0; i < len(p.lines); i++ {
+		k, next := parseLine(p.lines, i)
+		if k == key {
+			p.lines = append(p.lines[:i], append([]string{line}, p.lines[next:]...)...)
+			return
+		}
+		i = next - 1
+	}
+	p.lines = append(p.lines, line)
+}
+
+// parseLine returns the key of the logical line starting at lines[i] and the
+// index of the next logical line, accounting for backslash continuations.
+func parseLine(lines []string, i int) (string, int) {
+	next := i + 1
+	for l := lines[next-1]; next < len(lines) && continues(l); l = lines[next-1] {
+		next++
+	}
+
+	t := strings.TrimLeft(lines[i], " \t\f")
+	if t == "" || t[0] == '#' || t[0] == '!' {
+		return "", i + 1 // Comment lines are never continued.
+	}
+
+	end := strings.IndexAny(t, "=: \t\f")
+	for end > 0 && t[end-1] == '\\' { // Escaped separator.
+		rest := strings.IndexAny(t[end+1:], "=: \t\f")
+		if rest < 0 {
+			end = -1
+			break
+		}
+		end += rest + 1
+	}
+	if end < 0 {
+		end = len(t)
+	}
+	return t[:end], next
+}
+
+// continues reports whether the line ends with an odd number of backslashes.
+func continues(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+// groovyEscaper escapes a value for a single-quoted Groovy string.
+var groovyEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
+
+var initScriptTmpl = template.Must(template.New("init").Funcs(template.FuncMap{
+	"groovy": groovyEscaper.Replace,
+}).Parse(`// Generated by artifact-registry-cred-helper. DO NOT EDIT.
+//
+// Declares the Artifact Registry repositories for all projects. The credentials
+// are read from gradle.properties as <name>Username and <name>Password.
+def artifactRegistryRepos = [
+{{- range .}}
+    '{{.Name}}': '{{groovy .URL}}',
+{{- end}}
+]
+
+allprojects {
+    repositories {
+        artifactRegistryRepos.each { repoName, repoUrl ->
+            maven {
+                name = repoName
+                url = repoUrl
+                credentials(PasswordCredentials)
+            }
+        }
+    }
+}
+`))
+
+// WriteInitScript writes an init script under the init.d dir of the Gradle
+// user home that declares the given repos. The repos map repo IDs to repo URLs.
+// Repo IDs must only have letters and digits, as Gradle requires.
+func WriteInitScript(gradleUserHome string, repos map[string]string) error {
+	p, err := initScriptPath(gradleUserHome)
+	if err != nil {
+		return err
+	}
+
+	type repo struct{ Name, URL string }
+	data := make([]repo, 0, len(repos))
+	var merr error
+	for id, u := range repos {
+		if !validRepoID(id) {
+			merr = errors.Join(merr, fmt.Errorf("repo ID %q must only have letters and digits", id))
+			continue
+		}
+		if !strings.HasPrefix(u, "https://") {
+			u = "https://" + u
+		}
+		data = append(data, repo{Name: id, URL: u})
+	}
+	if merr != nil {
+		return merr
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Name < data[j].Name })
+
+	var b bytes.Buffer
+	if err := initScriptTmpl.Execute(&b, data); err != nil {
+		return fmt.Errorf("failed to render init script: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for %q: %w", p, err)
+	}
+	if err := atomicfile.Write(p, b.Bytes()); err != nil {
+		return fmt.Errorf("failed to save %q: %w", p, err)
+	}
+	return nil
+}
+
+// validRepoID reports whether the repo ID is not empty and only has letters
+// and digits.
+func validRepoID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveInitScript removes the init script written by WriteInitScript, if any.
+func RemoveInitScript(gradleUserHome string) error {
+	p, err := initScriptPath(gradleUserHome)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %q: %w", p, err)
+	}
+	return nil
+}
+
+// initScriptPath returns the path of our init script. The Gradle user home
+// could also be the properties file. If empty, UserHome is used.
+func initScriptPath(gradleUserHome string) (string, error) {
+	if gradleUserHome == "" {
+		h, err := UserHome()
+		if err != nil {
+			return "", err
+		}
+		gradleUserHome = h
+	}
+	if strings.HasSuffix(gradleUserHome, ".properties") {
+		gradleUserHome = filepath.Dir(gradleUserHome)
+	}
+	return filepath.Join(gradleUserHome, "init.d", InitScriptName), nil
+}
@@ -0,0 +1,275 @@
+package gradle
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDefaultRepoID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		repoURL string
+		want    string
+	}{
+		{
+			repoURL: "https://us-maven.pkg.dev/my-project/my-repo",
+			want:    "artifactregistryMyProjectMyRepo",
+		},
+		{
+			repoURL: "https://europe-maven.pkg.dev/project1/repo_2",
+			want:    "artifactregistryProject1Repo2",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.repoURL, func(t *testing.T) {
+			t.Parallel()
+			u, err := url.Parse(tc.repoURL)
+			if err != nil {
+				t.Fatalf("failed to parse URL: %v", err)
+			}
+			if got := DefaultRepoID(u); got != tc.want {
+				t.Errorf("DefaultRepoID(%q) = %q, want %q", tc.repoURL, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProperties_SetToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name: "empty_file",
+			want: "repo1Username=oauth2accesstoken\nrepo1Password=token\n",
+		},
+		{
+			name: "keep_other_properties",
+			content: `# Build settings.
+org.gradle.jvmargs=-Xmx2g \
+    -Dfile.encoding=UTF-8
+! Old style comment.
+repo1Password : old
+`,
+			want: `# Build settings.
+org.gradle.jvmargs=-Xmx2g \
+    -Dfile.encoding=UTF-8
+! Old style comment.
+repo1Password=token
+repo1Username=oauth2accesstoken
+`,
+		},
+		{
+			name:    "replace_continued_value",
+			content: "repo1Username oauth2\\\n  accesstoken\nrepo1Password=old\nother=value\n",
+			want:    "repo1Username=oauth2accesstoken\nrepo1Password=token\nother=value\n",
+		},
+		{
+			name:    "not_confused_by_prefix",
+			content: "myrepo1Username=someone\n#repo1Username=commented\n",
+			want:    "myrepo1Username=someone\n#repo1Username=commented\nrepo1Username=oauth2accesstoken\nrepo1Password=token\n",
+		},
+		{
+			name:    "keep_crlf",
+			content: "other=value\r\nrepo1Password=old\r\n",
+			want:    "other=value\r\nrepo1Password=token\r\nrepo1Username=oauth2accesstoken\r\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "gradle.properties")
+			if tc.content != "" {
+				if err := os.WriteFile(p, []byte(tc.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			props, err := Open(p)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			props.SetToken([]string{"repo1"}, "token")
+			if diff := cmp.Diff(tc.want, props.String()); diff != "" {
+				t.Errorf("SetToken() content (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProperties_Remove(t *testing.T) {
+	t.Parallel()
+
+	content := `# Build settings.
+org.gradle.jvmargs=-Xmx2g
+repo1Username=oauth2accesstoken
+repo1Password=token
+repo2Username : _json_key_base64
+repo2Password : \
+    key
+otherUsername=someone
+otherPassword=secret
+`
+
+	tests := []struct {
+		name    string
+		repoIDs []string
+		want    string
+	}{
+		{
+			name:    "given_repo",
+			repoIDs: []string{"repo1"},
+			want: `# Build settings.
+org.gradle.jvmargs=-Xmx2g
+repo2Username : _json_key_base64
+repo2Password : \
+    key
+otherUsername=someone
+otherPassword=secret
+`,
+		},
+		{
+			name: "all_repos",
+			want: `# Build settings.
+org.gradle.jvmargs=-Xmx2g
+otherUsername=someone
+otherPassword=secret
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "gradle.properties")
+			if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			props, err := Open(p)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			props.Remove(tc.repoIDs)
+			if diff := cmp.Diff(tc.want, props.String()); diff != "" {
+				t.Errorf("Remove() content (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProperties_Close(t *testing.T) {
+	t.Parallel()
+
+	home := filepath.Join(t.TempDir(), ".gradle")
+	props, err := Open(home)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	props.SetJSONKey([]string{"repo1"}, `a\b`)
+	if err := props.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(home, "gradle.properties"))
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	want := "repo1Username=_json_key_base64\nrepo1Password=a\\\\b\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Close() wrote (-want,+got):\n%s", diff)
+	}
+}
+
+func TestWriteInitScript(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	if err := WriteInitScript(home, map[string]string{
+		"repoB": "us-maven.pkg.dev/proj/b",
+		"repoA": "https://us-maven.pkg.dev/proj/a",
+	}); err != nil {
+		t.Fatalf("WriteInitScript() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(home, "init.d", InitScriptName))
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	want := `def artifactRegistryRepos = [
+    'repoA': 'https://us-maven.pkg.dev/proj/a',
+    'repoB': 'https://us-maven.pkg.dev/proj/b',
+]`
+	if !strings.Contains(string(got), want) {
+		t.Errorf("init script %q doesn't contain %q", got, want)
+	}
+	if !strings.Contains(string(got), "credentials(PasswordCredentials)") {
+		t.Errorf("init script %q doesn't declare PasswordCredentials", got)
+	}
+}
+
+func TestWriteInitScript_escape(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	if err := WriteInitScript(home, map[string]string{
+		"repo1": `us-maven.pkg.dev/proj/a'b\c`,
+	}); err != nil {
+		t.Fatalf("WriteInitScript() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(home, "init.d", InitScriptName))
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	want := `    'repo1': 'https://us-maven.pkg.dev/proj/a\'b\\c',`
+	if !strings.Contains(string(got), want) {
+		t.Errorf("init script %q doesn't contain %q", got, want)
+	}
+}
+
+func TestWriteInitScript_invalidRepoID(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	err := WriteInitScript(home, map[string]string{
+		"repo1":       "us-maven.pkg.dev/proj/repo1",
+		"x': 'y', 'z": "us-maven.pkg.dev/proj/repo2",
+	})
+	if want := `repo ID "x': 'y', 'z" must only have letters and digits`; err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("WriteInitScript() error = %v, want %q", err, want)
+	}
+	if _, err := os.Stat(filepath.Join(home, "init.d", InitScriptName)); !os.IsNotExist(err) {
+		t.Errorf("init script stat error = %v, want not exist", err)
+	}
+}
+
+func TestRemoveInitScript(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	if err := WriteInitScript(home, map[string]string{"repo1": "us-maven.pkg.dev/proj/repo1"}); err != nil {
+		t.Fatalf("WriteInitScript() error = %v", err)
+	}
+	if err := RemoveInitScript(home); err != nil {
+		t.Fatalf("RemoveInitScript() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "init.d", InitScriptName)); !os.IsNotExist(err) {
+		t.Errorf("init script still exists, stat error = %v", err)
+	}
+	// Removing again is a no-op.
+	if err := RemoveInitScript(home); err != nil {
+		t.Errorf("RemoveInitScript() again error = %v", err)
+	}
+}
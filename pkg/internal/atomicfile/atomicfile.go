@@ -0,0 +1,65 @@
+// Package atomicfile writes files atomically, so a crash mid-write never leaves
+// a truncated file behind.
+package atomicfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultMode is the mode of new files, which are likely to hold credentials.
+const DefaultMode fs.FileMode = 0o600
+
+// Write writes the data to a temp file in the same dir, fsyncs it and renames
+// it over the file. An existing file keeps its mode and, where possible, its
+// ownership; a new file gets DefaultMode. If the path is a symlink, its target
+// is written. The dir must exist.
+func Write(path string, data []byte) (retErr error) {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+
+	mode := DefaultMode
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil:
+		mode = fi.Mode().Perm()
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to stat %q: %w", path, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %q: %w", path, err)
+	}
+	defer func() {
+		if retErr != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write temp file for %q: %w", path, err)
+	}
+	if err := f.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to chmod temp file for %q: %w", path, err)
+	}
+	if fi != nil {
+		chown(f, fi)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file for %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file for %q: %w", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename temp file to %q: %w", path, err)
+	}
+
+	syncDir(filepath.Dir(path))
+	return nil
+}
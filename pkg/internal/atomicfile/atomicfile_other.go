@@ -0,0 +1,14 @@
+//go:build !unix
+
+package atomicfile
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chown is a no-op without Unix ownership.
+func chown(*os.File, fs.FileInfo) {}
+
+// syncDir is a no-op where dirs can't be fsynced.
+func syncDir(string) {}
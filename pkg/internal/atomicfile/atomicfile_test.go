@@ -0,0 +1,130 @@
+package atomicfile
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		existing *fs.FileMode
+		wantMode fs.FileMode
+	}{
+		{
+			name:     "new_file",
+			wantMode: DefaultMode,
+		},
+		{
+			name:     "keep_mode",
+			existing: ptr(fs.FileMode(0o640)),
+			wantMode: 0o640,
+		},
+		{
+			name:     "restrictive_mode",
+			existing: ptr(fs.FileMode(0o400)),
+			wantMode: 0o400,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			p := filepath.Join(dir, ".netrc")
+			if tc.existing != nil {
+				if err := os.WriteFile(p, []byte("old content that is longer"), *tc.existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := Write(p, []byte("new")); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			got, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "new" {
+				t.Errorf("content = %q, want %q", got, "new")
+			}
+			fi, err := os.Stat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runtime.GOOS != "windows" && fi.Mode().Perm() != tc.wantMode {
+				t.Errorf("mode = %v, want %v", fi.Mode().Perm(), tc.wantMode)
+			}
+			assertNoTempFiles(t, dir)
+		})
+	}
+}
+
+func TestWrite_symlink(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "netrc")
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, ".netrc")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(link, []byte("new")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("symlink replaced, Lstat() = %v, %v", fi, err)
+	}
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf("target content = %q, want %q", got, "new")
+	}
+}
+
+func TestWrite_missingDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := Write(filepath.Join(dir, "missing", ".netrc"), []byte("new")); err == nil {
+		t.Error("Write() got no error, want error")
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("temp files left behind: %v", matches)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package atomicfile
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// chown gives the file the ownership of the existing file. It's best effort,
+// since only root can give away files, and the file is still ours otherwise.
+func chown(f *os.File, existing fs.FileInfo) {
+	st, ok := existing.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	_ = f.Chown(int(st.Uid), int(st.Gid))
+}
+
+// syncDir fsyncs the dir so the rename is durable. It's best effort since the
+// file content is already durable.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
@@ -0,0 +1,154 @@
+// Package diff produces unified diffs of text files.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines around changes in a hunk.
+const context = 3
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	line string
+	// a and b are the 0-based line numbers in the old and new text before
+	// this op.
+	a, b int
+}
+
+// Unified returns the unified diff from the old text to the new one, or empty
+// if they are the same. The names are used in the file headers.
+func Unified(oldName, newName string, oldText, newText []byte) string {
+	if string(oldText) == string(newText) {
+		return ""
+	}
+
+	a, b := splitLines(string(oldText)), splitLines(string(newText))
+	ops := diffLines(a, b)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks(ops) {
+		writeHunk(&sb, h)
+	}
+	return sb.String()
+}
+
+// splitLines splits the text into lines, each with its line break if any, so
+// a missing line break at the end of the text is a difference.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the ops that turn a into b, based on the longest common
+// subsequence of the lines. Config files are small, so the quadratic time is
+// fine.
+func diffLines(a, b []string) []op {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{kind: opEqual, line: a[i], a: i, b: j})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, op{kind: opInsert, line: b[j], a: i, b: j})
+			j++
+		default:
+			ops = append(ops, op{kind: opDelete, line: a[i], a: i, b: j})
+			i++
+		}
+	}
+	return ops
+}
+
+// hunks groups the changes with their surrounding context. Changes separated
+// by at most twice the context are in the same hunk.
+func hunks(ops []op) [][]op {
+	var result [][]op
+	start, end := -1, -1
+	for i, o := range ops {
+		if o.kind == opEqual {
+			continue
+		}
+		if start >= 0 && i-end > context {
+			result = append(result, ops[start:end])
+			start = -1
+		}
+		if start < 0 {
+			start = max(i-context, 0)
+		}
+		end = min(i+context+1, len(ops))
+	}
+	if start >= 0 {
+		result = append(result, ops[start:end])
+	}
+	return result
+}
+
+func writeHunk(sb *strings.Builder, h []op) {
+	var aLen, bLen int
+	for _, o := range h {
+		if o.kind != opInsert {
+			aLen++
+		}
+		if o.kind != opDelete {
+			bLen++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(h[0].a, aLen), hunkRange(h[0].b, bLen))
+
+	for _, o := range h {
+		sb.WriteByte(byte(o.kind))
+		sb.WriteString(o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the range of a hunk from the 0-based start line. Like GNU
+// diff, an empty range starts at the line before, and a length of 1 is
+// omitted.
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
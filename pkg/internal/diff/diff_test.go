@@ -0,0 +1,123 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnified(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    string
+	}{
+		{
+			name:    "same",
+			oldText: "a\nb\n",
+			newText: "a\nb\n",
+			want:    "",
+		},
+		{
+			name:    "new_file",
+			newText: "a\nb\n",
+			want: `--- old
++++ new
+@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+		{
+			name:    "removed_content",
+			oldText: "a\n",
+			want: `--- old
++++ new
+@@ -1 +0,0 @@
+-a
+`,
+		},
+		{
+			name:    "change_in_middle",
+			oldText: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			newText: "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: `--- old
++++ new
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			name:    "separate_hunks",
+			oldText: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			newText: "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n",
+			want: `--- old
++++ new
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`,
+		},
+		{
+			name:    "merged_hunks",
+			oldText: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			newText: "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: `--- old
++++ new
+@@ -1,8 +1,8 @@
+-1
++one
+ 2
+ 3
+ 4
+ 5
+ 6
+ 7
+-8
++eight
+`,
+		},
+		{
+			name:    "no_newline_at_end",
+			oldText: "a\nb",
+			newText: "a\nb\n",
+			want: `--- old
++++ new
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := Unified("old", "new", []byte(tc.oldText), []byte(tc.newText))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unified() (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
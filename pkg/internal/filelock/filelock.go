@@ -0,0 +1,57 @@
+// Package filelock serializes read-modify-write cycles on a file across
+// processes with an advisory lock on a sidecar lock file.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Suffix is appended to the path of the file to get its lock file.
+const Suffix = ".lock"
+
+// Lock is an exclusive lock on a file.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire blocks until it holds the exclusive lock of the file at path. The
+// lock is taken on a sidecar file rather than the file itself, since the file
+// is replaced on write. The lock file is created along with its dir if
+// missing, and left in place on Release so waiting processes keep locking the
+// same file.
+func Acquire(path string) (*Lock, error) {
+	lockPath := path + Suffix
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create dir for %q: %w", lockPath, err)
+	}
+
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %q: %w", lockPath, err)
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %q: %w", lockPath, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock. It's safe to call on a nil or released lock.
+func (l *Lock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	f := l.f
+	l.f = nil
+
+	if err := unlock(f); err != nil {
+		return errors.Join(fmt.Errorf("failed to unlock %q: %w", f.Name(), err), f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close lock file %q: %w", f.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "sub", ".netrc")
+
+	l, err := Acquire(p)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := os.Stat(p + Suffix); err != nil {
+		t.Errorf("lock file not created: %v", err)
+	}
+
+	acquired := make(chan *Lock)
+	go func() {
+		l2, err := Acquire(p)
+		if err != nil {
+			t.Errorf("second Acquire() error = %v", err)
+		}
+		acquired <- l2
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second Acquire() got the lock while it was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	select {
+	case l2 := <-acquired:
+		if err := l2.Release(); err != nil {
+			t.Errorf("Release() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second Acquire() didn't get the lock after it was released")
+	}
+
+	// Releasing again is a no-op.
+	if err := l.Release(); err != nil {
+		t.Errorf("second Release() error = %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+// Package ini provides a minimal line-based editor for INI files. It only
+// touches the lines it is asked to change so that comments, ordering and
+// formatting of everything else are preserved.
+package ini
+
+import (
+	"strings"
+)
+
+// File is an INI file as a list of lines without line endings.
+type File struct {
+	Lines []string
+
+	// crlf is whether the file uses CRLF line endings, which are kept when it
+	// is written back.
+	crlf bool
+}
+
+// Option is a key-value entry in a section, including its continuation lines.
+type Option struct {
+	// Key is the lower-cased key.
+	Key string
+	// Values are the whitespace separated values across all lines.
+	Values []string
+	// Start is the index of the first line.
+	Start int
+	// End is the index after the last continuation line.
+	End int
+}
+
+// Parse parses the content of an INI file.
+func Parse(data []byte) *File {
+	crlf := strings.Contains(string(data), "\r\n")
+	content := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if content == "" {
+		return &File{crlf: crlf}
+	}
+	return &File{Lines: strings.Split(content, "\n"), crlf: crlf}
+}
+
+// String returns the content of the file.
+func (f *File) String() string {
+	if len(f.Lines) == 0 {
+		return ""
+	}
+	eol := "\n"
+	if f.crlf {
+		eol = "\r\n"
+	}
+	return strings.Join(f.Lines, eol) + eol
+}
+
+// Sections returns the names of all sections in order.
+func (f *File) Sections() []string {
+	var names []string
+	for _, l := range f.Lines {
+		if name, ok := sectionName(l); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Section returns the range of lines [start, end) of the given section, where
+// start is the index of the section header. It returns -1 if the section is
+// not found.
+func (f *File) Section(name string) (int, int) {
+	start := -1
+	for i, l := range f.Lines {
+		n, ok := sectionName(l)
+		if !ok {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if n == name {
+			start = i
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+	return start, len(f.Lines)
+}
+
+// AddSection appends a new section at the end of the file and returns its
+// range of lines.
+func (f *File) AddSection(name string) (int, int) {
+	if len(f.Lines) > 0 && strings.TrimSpace(f.Lines[len(f.Lines)-1]) != "" {
+		f.Lines = append(f.Lines, "")
+	}
+	f.Lines = append(f.Lines, "["+name+"]")
+	return len(f.Lines) - 1, len(f.Lines)
+}
+
+// RemoveSection removes the given section and all its lines, including the
+// blank lines preceding it.
+func (f *File) RemoveSection(name string) {
+	start, end := f.Section(name)
+	if start < 0 {
+		return
+	}
+	for start > 0 && strings.TrimSpace(f.Lines[start-1]) == "" {
+		start--
+	}
+	f.Splice(start, end, nil)
+}
+
+// Options parses the options in the lines [start, end).
+func (f *File) Options(start, end int) []*Option {
+	var opts []*Option
+	var cur *Option
+	for i := start; i < end; i++ {
+		l := f.Lines[i]
+		t := strings.TrimSpace(l)
+
+		// Continuation lines are indented.
+		if cur != nil && t != "" && l != strings.TrimLeft(l, " \t") {
+			if !isComment(t) {
+				cur.Values = append(cur.Values, strings.Fields(t)...)
+			}
+			cur.End = i + 1
+			continue
+		}
+
+		cur = nil
+		if t == "" || isComment(t) {
+			continue
+		}
+		if _, ok := sectionName(l); ok {
+			continue
+		}
+
+		sep := strings.IndexAny(t, "=:")
+		if sep < 0 {
+			continue
+		}
+		cur = &Option{
+			Key:    strings.ToLower(strings.TrimSpace(t[:sep])),
+			Values: strings.Fields(t[sep+1:]),
+			Start:  i,
+			End:    i + 1,
+		}
+		opts = append(opts, cur)
+	}
+	return opts
+}
+
+// Option returns the option with the given key in the lines [start, end), or
+// nil if not found.
+func (f *File) Option(start, end int, key string) *Option {
+	for _, o := range f.Options(start, end) {
+		if o.Key == key {
+			return o
+		}
+	}
+	return nil
+}
+
+// Set sets the values of the key in the given section, creating the section
+// if needed. Existing options are replaced in place, new ones are added to the
+// end of the section.
+func (f *File) Set(section, key string, values []string) {
+	start, end := f.Section(section)
+	if start < 0 {
+		start, end = f.AddSection(section)
+	}
+	lines := FormatOption(key, values)
+	if o := f.Option(start+1, end, key); o != nil {
+		f.Splice(o.Start, o.End, lines)
+		return
+	}
+
+	// Insert before the trailing blank lines of the section.
+	for end > start+1 && strings.TrimSpace(f.Lines[end-1]) == "" {
+		end--
+	}
+	f.Splice(end, end, lines)
+}
+
+// Splice replaces the lines [start, end) with the given lines.
+func (f *File) Splice(start, end int, lines []string) {
+	f.Lines = append(f.Lines[:start], append(lines, f.Lines[end:]...)...)
+}
+
+// FormatOption formats the option lines. Multiple values are put on
+// continuation lines.
+func FormatOption(key string, values []string) []string {
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return []string{key + " = " + values[0]}
+	}
+	lines := []string{key + " ="}
+	for _, v := range values {
+		lines = append(lines, "    "+v)
+	}
+	return lines
+}
+
+func sectionName(line string) (string, bool) {
+	t := strings.TrimSpace(line)
+	if !strings.HasPrefix(t, "[") || !strings.HasSuffix(t, "]") {
+		return "", false
+	}
+	return strings.TrimSpace(t[1 : len(t)-1]), true
+}
+
+func isComment(t string) bool {
+	return strings.HasPrefix(t, "#") || strings.HasPrefix(t, ";")
+}
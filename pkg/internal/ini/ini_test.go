@@ -0,0 +1,95 @@
+package ini
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFile_Set(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		section string
+		key     string
+		values  []string
+		want    string
+	}{
+		{
+			name:    "new_section",
+			content: "[a]\nx = 1\n",
+			section: "b",
+			key:     "y",
+			values:  []string{"2"},
+			want:    "[a]\nx = 1\n\n[b]\ny = 2\n",
+		},
+		{
+			name:    "replace_with_continuation",
+			content: "[a]\nx =\n    1\n    2\n; comment\nz = 3\n",
+			section: "a",
+			key:     "x",
+			values:  []string{"4"},
+			want:    "[a]\nx = 4\n; comment\nz = 3\n",
+		},
+		{
+			name:    "append_before_blank_lines",
+			content: "[a]\nx = 1\n\n[b]\n",
+			section: "a",
+			key:     "y",
+			values:  []string{"2", "3"},
+			want:    "[a]\nx = 1\ny =\n    2\n    3\n\n[b]\n",
+		},
+		{
+			name:    "remove",
+			content: "[a]\nx = 1\ny = 2\n",
+			section: "a",
+			key:     "x",
+			want:    "[a]\ny = 2\n",
+		},
+		{
+			name:    "keep_crlf",
+			content: "[a]\r\nx = 1\r\n",
+			section: "b",
+			key:     "y",
+			values:  []string{"2", "3"},
+			want:    "[a]\r\nx = 1\r\n\r\n[b]\r\ny =\r\n    2\r\n    3\r\n",
+		},
+		{
+			name:    "keep_crlf_unchanged",
+			content: "[a]\r\nx = 1\r\n; comment\r\n",
+			section: "a",
+			key:     "x",
+			values:  []string{"1"},
+			want:    "[a]\r\nx = 1\r\n; comment\r\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := Parse([]byte(tc.content))
+			f.Set(tc.section, tc.key, tc.values)
+			if diff := cmp.Diff(tc.want, f.String()); diff != "" {
+				t.Errorf("Set() content (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFile_Options(t *testing.T) {
+	t.Parallel()
+
+	f := Parse([]byte("[a]\r\nX = 1 2\r\n  3\r\n# c\r\ny: 4\r\n[b]\r\nz = 5\r\n"))
+	start, end := f.Section("a")
+	got := f.Options(start+1, end)
+	want := []*Option{
+		{Key: "x", Values: []string{"1", "2", "3"}, Start: 1, End: 3},
+		{Key: "y", Values: []string{"4"}, Start: 4, End: 5},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Options() (-want,+got):\n%s", diff)
+	}
+}
@@ -1,6 +1,7 @@
 package maven
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -9,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/beevik/etree"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/atomicfile"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/filelock"
 )
 
 // DefaultRepoID is our default way to construct repo ID used in pom.xml and
@@ -16,20 +19,62 @@ import (
 //
 // Given repo URL: us-maven.pkg.dev/my-project/my-repo
 // Default repo ID: artifactregistry-my-project-my-repo
+//
+// A trailing slash in the repo URL doesn't change the ID.
 func DefaultRepoID(repoURL *url.URL) string {
-	return "artifactregistry" + strings.ReplaceAll(repoURL.Path, "/", "-")
+	return "artifactregistry" + strings.ReplaceAll(strings.TrimSuffix(repoURL.Path, "/"), "/", "-")
+}
+
+// Credential is a server with Artifact Registry credentials in settings.xml.
+type Credential struct {
+	RepoID   string
+	Username string
+	Password string
 }
 
 type Settings struct {
-	path string
-	doc  *etree.Document
+	path     string
+	original []byte
+	doc      *etree.Document
+	lock     *filelock.Lock
 }
 
+// Open reads the settings.xml file without locking it. Use OpenLocked to
+// update the file.
 func Open(settingsPath string) (*Settings, error) {
+	settingsPath, err := resolvePath(settingsPath)
+	if err != nil {
+		return nil, err
+	}
+	return read(settingsPath)
+}
+
+// OpenLocked is like Open, but holds an exclusive lock on the file until
+// Close or Discard, so concurrent updates from other processes don't lose
+// each other's changes.
+func OpenLocked(settingsPath string) (*Settings, error) {
+	settingsPath, err := resolvePath(settingsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := filelock.Acquire(settingsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock Maven settings.xml file: %w", err)
+	}
+	s, err := read(settingsPath)
+	if err != nil {
+		return nil, errors.Join(err, lock.Release())
+	}
+	s.lock = lock
+	return s, nil
+}
+
+func resolvePath(settingsPath string) (string, error) {
 	if settingsPath == "" {
 		h, err := os.UserHomeDir()
 		if err != nil {
-			return nil, fmt.Errorf("cannot open .netrc file: %w", err)
+			return "", fmt.Errorf("cannot open .netrc file: %w", err)
 		}
 		settingsPath = path.Join(h, ".m2")
 	}
@@ -37,15 +82,18 @@ func Open(settingsPath string) (*Settings, error) {
 	if !strings.HasSuffix(settingsPath, "settings.xml") {
 		settingsPath = path.Join(settingsPath, "settings.xml")
 	}
+	return settingsPath, nil
+}
 
+func read(settingsPath string) (*Settings, error) {
 	doc := etree.NewDocument()
-	_, err := os.Stat(settingsPath)
+	original, err := os.ReadFile(settingsPath)
 	if err != nil && !os.IsNotExist(err) { // Handle other errors.
-		return nil, fmt.Errorf("failed to stat Maven settings.xml file: %w", err)
+		return nil, fmt.Errorf("failed to read Maven settings.xml file: %w", err)
 	}
 
 	if err == nil { // File exists.
-		if err := doc.ReadFromFile(settingsPath); err != nil {
+		if err := doc.ReadFromBytes(original); err != nil {
 			return nil, fmt.Errorf("cannot load Maven settings.xml file at %q: %w", settingsPath, err)
 		}
 	} else {
@@ -56,23 +104,56 @@ func Open(settingsPath string) (*Settings, error) {
 		settings.CreateAttr("xsi:schemaLocation", "http://maven.apache.org/SETTINGS/1.0.0 http://maven.apache.org/xsd/settings-1.0.0.xsd")
 	}
 
-	return &Settings{path: settingsPath, doc: doc}, nil
+	return &Settings{path: settingsPath, original: original, doc: doc}, nil
+}
+
+// Path returns the path of the settings.xml file.
+func (s *Settings) Path() string {
+	return s.path
+}
+
+// Original returns the content of the file when opened.
+func (s *Settings) Original() []byte {
+	return s.original
+}
+
+// Marshal returns the content Close writes.
+func (s *Settings) Marshal() ([]byte, error) {
+	s.doc.Indent(2) // Make it pretty.
+	b, err := s.doc.WriteToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Maven settings.xml: %w", err)
+	}
+	return b, nil
 }
 
-func (s *Settings) Close() error {
+// Close writes the file and releases the lock if any.
+func (s *Settings) Close() (retErr error) {
+	defer func() {
+		retErr = errors.Join(retErr, s.Discard())
+	}()
+
 	// mkdir for the settings file since etree doesn't handle that.
 	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
 		return fmt.Errorf("failed to create Maven settings.xml directory: %w", err)
 	}
 
-	s.doc.Indent(2) // Make it pretty.
-	if err := s.doc.WriteToFile(s.path); err != nil {
+	b, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.Write(s.path, b); err != nil {
 		return fmt.Errorf("failed to save Maven settings.xml at %q: %w", s.path, err)
 	}
 
 	return nil
 }
 
+// Discard releases the lock if any without writing the file.
+func (s *Settings) Discard() error {
+	return s.lock.Release()
+}
+
 func (s *Settings) SetToken(repoIDs []string, token string) {
 	s.update(repoIDs, "oauth2accesstoken", token)
 }
@@ -81,6 +162,63 @@ func (s *Settings) SetJSONKey(repoIDs []string, base64Key string) {
 	s.update(repoIDs, "_json_key_base64", base64Key)
 }
 
+// Remove removes the servers of the given repo IDs, or all servers with
+// Artifact Registry credentials if no repo ID is given. Other servers are left
+// intact.
+func (s *Settings) Remove(repoIDs []string) {
+	servers := s.doc.FindElement("//settings/servers")
+	if servers == nil {
+		return
+	}
+
+	set := make(map[string]struct{}, len(repoIDs))
+	for _, id := range repoIDs {
+		set[id] = struct{}{}
+	}
+	for _, server := range servers.ChildElements() {
+		if len(repoIDs) == 0 {
+			username := server.FindElement("username")
+			if username == nil || (username.Text() != "oauth2accesstoken" && username.Text() != "_json_key_base64") {
+				continue
+			}
+		} else {
+			idElem := server.FindElement("id")
+			if idElem == nil {
+				continue
+			}
+			if _, ok := set[idElem.Text()]; !ok {
+				continue
+			}
+		}
+		servers.RemoveChild(server)
+	}
+}
+
+// Credentials returns the servers with Artifact Registry credentials in order.
+func (s *Settings) Credentials() []Credential {
+	servers := s.doc.FindElement("//settings/servers")
+	if servers == nil {
+		return nil
+	}
+
+	var creds []Credential
+	for _, server := range servers.ChildElements() {
+		username := server.FindElement("username")
+		if username == nil || (username.Text() != "oauth2accesstoken" && username.Text() != "_json_key_base64") {
+			continue
+		}
+		cred := Credential{Username: username.Text()}
+		if id := server.FindElement("id"); id != nil {
+			cred.RepoID = id.Text()
+		}
+		if password := server.FindElement("password"); password != nil {
+			cred.Password = password.Text()
+		}
+		creds = append(creds, cred)
+	}
+	return creds
+}
+
 func (s *Settings) update(repoIDs []string, user, pwd string) {
 	servers := s.doc.FindElement("//settings/servers")
 	if servers == nil { // Create servers if it doesn't exist
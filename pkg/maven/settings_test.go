@@ -28,6 +28,10 @@ func TestDefaultRepoID(t *testing.T) {
 			repoURL:  "https://asia-maven.pkg.dev/yet-another-project/yet-another-repo",
 			expected: "artifactregistry-yet-another-project-yet-another-repo",
 		},
+		{
+			repoURL:  "https://us-maven.pkg.dev/my-project/my-repo/",
+			expected: "artifactregistry-my-project-my-repo",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -268,3 +272,47 @@ func TestSettings_Close(t *testing.T) {
 		}
 	})
 }
+
+func TestSettings_Remove(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		repoIDs []string
+		wantIDs []string
+	}{
+		{
+			name:    "given repo IDs",
+			repoIDs: []string{"repo1"},
+			wantIDs: []string{"other", "repo2"},
+		},
+		{
+			name:    "all Artifact Registry servers",
+			wantIDs: []string{"other"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			settings, err := Open(filepath.Join(t.TempDir(), "settings.xml"))
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			settings.update([]string{"other"}, "user", "pass")
+			settings.SetToken([]string{"repo1"}, "token")
+			settings.SetJSONKey([]string{"repo2"}, "key")
+
+			settings.Remove(tc.repoIDs)
+
+			var gotIDs []string
+			for _, id := range settings.doc.FindElements("//settings/servers/server/id") {
+				gotIDs = append(gotIDs, id.Text())
+			}
+			if diff := cmp.Diff(tc.wantIDs, gotIDs); diff != "" {
+				t.Errorf("server IDs (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -2,47 +2,95 @@
 package netrc
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strings"
+
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/atomicfile"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/filelock"
 )
 
-var (
-	catchAllPattern = regexp.MustCompile("\nmachine (.*.pkg.dev)\nlogin (oauth2accesstoken|_json_key_base64)\npassword (.*)\n")
-	tokenPattern    = regexp.MustCompile("\nmachine (.*.pkg.dev)\nlogin oauth2accesstoken\npassword (.*)\n")
+const (
+	tokenLogin   = "oauth2accesstoken"
+	jsonKeyLogin = "_json_key_base64"
 )
 
 func tokenFormat(host, token string) string {
 	return fmt.Sprintf(`
 machine %s
-login oauth2accesstoken
+login %s
 password %s
-`, host, token)
+`, host, tokenLogin, token)
 }
 
 func jsonKeyFormat(host, base64Key string) string {
 	return fmt.Sprintf(`
 machine %s
-login _json_key_base64
+login %s
 password %s
-`, host, base64Key)
+`, host, jsonKeyLogin, base64Key)
+}
+
+// Credential is an Artifact Registry entry in a netrc file.
+type Credential struct {
+	Host     string
+	Login    string
+	Password string
 }
 
 type NetRC struct {
-	path    string
-	content string
+	path     string
+	original string
+	content  string
+	merge    bool
+	lock     *filelock.Lock
 }
 
+// Open reads the netrc file without locking it. Use OpenLocked to update the
+// file.
 func Open(netrcPath string) (*NetRC, error) {
-	if netrcPath == "" {
-		h, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("cannot find HOME dir: %w", err)
-		}
-		netrcPath = filepath.Join(h, ".netrc")
+	netrcPath, err := resolvePath(netrcPath)
+	if err != nil {
+		return nil, err
 	}
+	return read(netrcPath)
+}
 
+// OpenLocked is like Open, but holds an exclusive lock on the file until
+// Close or Discard, so concurrent updates from other processes don't lose
+// each other's changes.
+func OpenLocked(netrcPath string) (*NetRC, error) {
+	netrcPath, err := resolvePath(netrcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := filelock.Acquire(netrcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %q: %w", netrcPath, err)
+	}
+	n, err := read(netrcPath)
+	if err != nil {
+		return nil, errors.Join(err, lock.Release())
+	}
+	n.lock = lock
+	return n, nil
+}
+
+func resolvePath(netrcPath string) (string, error) {
+	if netrcPath != "" {
+		return netrcPath, nil
+	}
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find HOME dir: %w", err)
+	}
+	return filepath.Join(h, ".netrc"), nil
+}
+
+func read(netrcPath string) (*NetRC, error) {
 	data, err := os.ReadFile(netrcPath)
 	if os.IsNotExist(err) {
 		return &NetRC{path: netrcPath, content: ""}, nil
@@ -50,48 +98,128 @@ func Open(netrcPath string) (*NetRC, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot load file %q: %v", netrcPath, err)
 	}
-	return &NetRC{path: netrcPath, content: string(data)}, nil
+	return &NetRC{path: netrcPath, original: string(data), content: string(data)}, nil
+}
+
+// Path returns the path of the netrc file.
+func (n *NetRC) Path() string {
+	return n.path
+}
+
+// Original returns the content of the file when opened.
+func (n *NetRC) Original() []byte {
+	return []byte(n.original)
+}
+
+// Marshal returns the content Close writes.
+func (n *NetRC) Marshal() ([]byte, error) {
+	return []byte(n.content), nil
+}
+
+// SetMerge sets whether SetToken and SetJSONKey only replace the entries of
+// the given hosts. By default, all Artifact Registry entries are replaced.
+func (n *NetRC) SetMerge(merge bool) {
+	n.merge = merge
 }
 
 func (n *NetRC) SetToken(hosts []string, token string) {
-	n.update(hosts, tokenFormat, token, false)
+	n.update(hosts, tokenFormat, token, n.merge)
 }
 
 func (n *NetRC) SetJSONKey(hosts []string, base64Key string) {
-	n.update(hosts, jsonKeyFormat, base64Key, false)
+	n.update(hosts, jsonKeyFormat, base64Key, n.merge)
+}
+
+// Remove removes the Artifact Registry credentials of the given hosts, or all
+// of them if no host is given. Other entries are left intact.
+func (n *NetRC) Remove(hosts []string) {
+	set := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		set[h] = struct{}{}
+	}
+
+	n.content = parse(n.content).remove(func(e *entry) bool {
+		if !e.isArtifactRegistry() {
+			return false
+		}
+		_, ok := set[e.machine]
+		return ok || len(hosts) == 0
+	})
+}
+
+// Credentials returns the Artifact Registry entries in order.
+func (n *NetRC) Credentials() []Credential {
+	var creds []Credential
+	for _, e := range parse(n.content).entries {
+		if e.isArtifactRegistry() {
+			creds = append(creds, Credential{Host: e.machine, Login: e.login, Password: e.password})
+		}
+	}
+	return creds
+}
+
+// Redact returns the content, e.g. of Original or Marshal, with the password
+// and account values replaced with the mask. The values are found by the same
+// tokenizer that reads the file, so quoted values and values on the next line
+// are covered.
+func (n *NetRC) Redact(content []byte, mask string) []byte {
+	return []byte(parse(string(content)).redact(mask))
 }
 
+// Refresh replaces the password of the Artifact Registry entries with access
+// tokens in place.
 func (n *NetRC) Refresh(token string) {
-	n.content = tokenPattern.ReplaceAllString(n.content, "\nmachine $1\nlogin oauth2accesstoken\npassword "+token+"\n")
+	f := parse(n.content)
+
+	var sb strings.Builder
+	last := 0
+	for _, e := range f.entries {
+		if !e.isArtifactRegistry() || e.login != tokenLogin || e.passwordToken == nil {
+			continue
+		}
+		sb.WriteString(n.content[last:e.passwordToken.start])
+		sb.WriteString(token)
+		last = e.passwordToken.end
+	}
+	sb.WriteString(n.content[last:])
+	n.content = sb.String()
 }
 
-func (n *NetRC) Close() error {
+// Close writes the file and releases the lock if any.
+func (n *NetRC) Close() (retErr error) {
+	defer func() {
+		retErr = errors.Join(retErr, n.Discard())
+	}()
+
 	// Make sure dir exists.
 	if err := os.MkdirAll(filepath.Dir(n.path), 0755); err != nil {
 		return fmt.Errorf("failed to create dir for %q: %w", n.path, err)
 	}
 
-	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0777)
-	if err != nil {
-		return fmt.Errorf("failed to open %q: %w", n.path, err)
-	}
-	defer f.Close()
-
-	if _, err := f.WriteString(n.content); err != nil {
+	if err := atomicfile.Write(n.path, []byte(n.content)); err != nil {
 		return fmt.Errorf("failed to save %q: %w", n.path, err)
 	}
 	return nil
 }
 
-func (n *NetRC) update(hosts []string, formatter func(string, string) string, pwd string, append bool) {
-	content := n.content
-	if !append {
-		// First clean up existing credentials.
-		content = catchAllPattern.ReplaceAllString(n.content, "")
+// Discard releases the lock if any without writing the file.
+func (n *NetRC) Discard() error {
+	return n.lock.Release()
+}
+
+// update replaces the Artifact Registry entries with the given hosts. With
+// merge, only the entries of the given hosts are replaced.
+func (n *NetRC) update(hosts []string, formatter func(string, string) string, pwd string, merge bool) {
+	// First clean up existing credentials.
+	if merge {
+		n.Remove(hosts)
+	} else {
+		n.Remove(nil)
 	}
 	// Add new credentials.
+	var sb strings.Builder
 	for _, h := range hosts {
-		content = content + formatter(h, pwd)
+		sb.WriteString(formatter(h, pwd))
 	}
-	n.content = content
+	n.content = parse(n.content).insert(sb.String())
 }
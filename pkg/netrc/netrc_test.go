@@ -3,9 +3,12 @@ package netrc
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestNetRC_SetToken(t *testing.T) {
@@ -44,6 +47,53 @@ func TestNetRC_SetJSONKey(t *testing.T) {
 	}
 }
 
+func TestNetRC_Redact(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "entries",
+			content: "machine us-go.pkg.dev\nlogin oauth2accesstoken\npassword ya29.token\nmachine example.com login me password secret\n",
+			want:    "machine us-go.pkg.dev\nlogin oauth2accesstoken\npassword REDACTED\nmachine example.com login me password REDACTED\n",
+		},
+		{
+			name:    "value on the next line",
+			content: "machine example.com login me password\n  secret\n",
+			want:    "machine example.com login me password\n  REDACTED\n",
+		},
+		{
+			name:    "quoted value",
+			content: "machine example.com login me password \"a b\" # comment\n",
+			want:    "machine example.com login me password REDACTED # comment\n",
+		},
+		{
+			name:    "account",
+			content: "machine example.com login me account acct password pwd\n",
+			want:    "machine example.com login me account REDACTED password REDACTED\n",
+		},
+		{
+			name:    "outside entries",
+			content: "password secret\n",
+			want:    "password REDACTED\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := (&NetRC{}).Redact([]byte(tc.content), "REDACTED")
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("Redact() (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestNetRC_Refresh(t *testing.T) {
 	t.Parallel()
 
@@ -115,6 +165,11 @@ func TestNetRC_Close(t *testing.T) {
 		if string(content) != expectedContent {
 			t.Errorf("Close() wrote %q, want %q", string(content), expectedContent)
 		}
+		if fi, err := os.Stat(netrcPath); err != nil {
+			t.Fatal(err)
+		} else if runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+			t.Errorf("Close() wrote file with mode %v, want %v", fi.Mode().Perm(), os.FileMode(0o600))
+		}
 	})
 
 	t.Run("directory_creation", func(t *testing.T) {
@@ -164,9 +219,77 @@ func TestNetRC_Close(t *testing.T) {
 	})
 }
 
+func TestOpenLocked(t *testing.T) {
+	t.Parallel()
+
+	netrcPath := filepath.Join(t.TempDir(), ".netrc")
+	if err := os.WriteFile(netrcPath, []byte("machine example.com login me password secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := OpenLocked(netrcPath)
+	if err != nil {
+		t.Fatalf("OpenLocked() error = %v", err)
+	}
+
+	opened := make(chan *NetRC)
+	go func() {
+		second, err := OpenLocked(netrcPath)
+		if err != nil {
+			t.Errorf("second OpenLocked() error = %v", err)
+		}
+		opened <- second
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("second OpenLocked() returned while the file was locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	first.SetToken([]string{"us-go.pkg.dev"}, "token")
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	select {
+	case second := <-opened:
+		// The second one must see the changes made under the lock.
+		want := "machine example.com login me password secret\n" + tokenFormat("us-go.pkg.dev", "token")
+		if string(second.Original()) != want {
+			t.Errorf("second OpenLocked() read %q, want %q", second.Original(), want)
+		}
+		if err := second.Discard(); err != nil {
+			t.Errorf("Discard() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second OpenLocked() didn't return after the lock was released")
+	}
+}
+
 func TestNetRC_update(t *testing.T) {
 	t.Parallel()
 
+	t.Run("merge_mode", func(t *testing.T) {
+		t.Parallel()
+
+		n := &NetRC{content: "existing content\n\nmachine existing.pkg.dev\nlogin oauth2accesstoken\npassword token\n" +
+			"\nmachine new.pkg.dev\nlogin oauth2accesstoken\npassword old\n"}
+		hosts := []string{"new.pkg.dev"}
+		formatter := func(host, pwd string) string {
+			return "\nmachine " + host + "\nlogin test\npassword " + pwd + "\n"
+		}
+
+		n.update(hosts, formatter, "pwd", true)
+
+		expected := "existing content\n\nmachine existing.pkg.dev\nlogin oauth2accesstoken\npassword token\n" +
+			"\nmachine new.pkg.dev\nlogin test\npassword pwd\n"
+
+		if n.content != expected {
+			t.Errorf("update() with merge content = %q, want %q", n.content, expected)
+		}
+	})
+
 	t.Run("append_mode", func(t *testing.T) {
 		t.Parallel()
 
@@ -224,3 +347,250 @@ func TestNetRC_update(t *testing.T) {
 		}
 	})
 }
+
+func TestNetRC_Remove(t *testing.T) {
+	t.Parallel()
+
+	content := "machine example.com\nlogin user\npassword pass\n" +
+		"\nmachine host1.pkg.dev\nlogin oauth2accesstoken\npassword token1\n" +
+		"\nmachine host2.pkg.dev\nlogin _json_key_base64\npassword key2\n"
+
+	tests := []struct {
+		name  string
+		hosts []string
+		want  string
+	}{
+		{
+			name:  "given hosts",
+			hosts: []string{"host1.pkg.dev"},
+			want: "machine example.com\nlogin user\npassword pass\n" +
+				"\nmachine host2.pkg.dev\nlogin _json_key_base64\npassword key2\n",
+		},
+		{
+			name: "all hosts",
+			want: "machine example.com\nlogin user\npassword pass\n",
+		},
+		{
+			name:  "unknown host",
+			hosts: []string{"host3.pkg.dev"},
+			want:  content,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			n := &NetRC{content: content}
+			n.Remove(tc.hosts)
+			if n.content != tc.want {
+				t.Errorf("Remove() content = %q, want %q", n.content, tc.want)
+			}
+		})
+	}
+}
+
+func TestNetRC_layouts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		content    string
+		wantCreds  []Credential
+		wantRemove string
+		wantSet    string
+	}{
+		{
+			name:       "single line entries",
+			content:    "machine example.com login me password secret\nmachine us-go.pkg.dev login oauth2accesstoken password old\n",
+			wantCreds:  []Credential{{Host: "us-go.pkg.dev", Login: "oauth2accesstoken", Password: "old"}},
+			wantRemove: "machine example.com login me password secret\n",
+			wantSet:    "machine example.com login me password secret\n" + tokenFormat("us-go.pkg.dev", "new"),
+		},
+		{
+			name:       "entries on the same line",
+			content:    "machine example.com login me password secret machine us-go.pkg.dev login oauth2accesstoken password old\n",
+			wantCreds:  []Credential{{Host: "us-go.pkg.dev", Login: "oauth2accesstoken", Password: "old"}},
+			wantRemove: "machine example.com login me password secret\n",
+			wantSet:    "machine example.com login me password secret\n" + tokenFormat("us-go.pkg.dev", "new"),
+		},
+		{
+			name:       "first entry with tabs",
+			content:    "machine us-go.pkg.dev\n\tlogin oauth2accesstoken\n\tpassword old\n\nmachine example.com\n\tlogin me\n",
+			wantCreds:  []Credential{{Host: "us-go.pkg.dev", Login: "oauth2accesstoken", Password: "old"}},
+			wantRemove: "machine example.com\n\tlogin me\n",
+			wantSet:    "machine example.com\n\tlogin me\n" + tokenFormat("us-go.pkg.dev", "new"),
+		},
+		{
+			name:       "crlf",
+			content:    "machine example.com\r\nlogin me\r\npassword secret\r\n\r\nmachine us-go.pkg.dev\r\nlogin _json_key_base64\r\npassword key\r\n",
+			wantCreds:  []Credential{{Host: "us-go.pkg.dev", Login: "_json_key_base64", Password: "key"}},
+			wantRemove: "machine example.com\r\nlogin me\r\npassword secret\r\n",
+			wantSet:    "machine example.com\r\nlogin me\r\npassword secret\r\n\r\nmachine us-go.pkg.dev\r\nlogin oauth2accesstoken\r\npassword new\r\n",
+		},
+		{
+			name: "duplicates",
+			content: "machine us-go.pkg.dev login oauth2accesstoken password old1\n" +
+				"machine us-go.pkg.dev\nlogin oauth2accesstoken\npassword old2\n",
+			wantCreds: []Credential{
+				{Host: "us-go.pkg.dev", Login: "oauth2accesstoken", Password: "old1"},
+				{Host: "us-go.pkg.dev", Login: "oauth2accesstoken", Password: "old2"},
+			},
+			wantRemove: "",
+			wantSet:    tokenFormat("us-go.pkg.dev", "new")[1:],
+		},
+		{
+			name: "comments and quotes",
+			content: "# Work.\nmachine example.com login me password #secret # Not a password.\n" +
+				"# Artifact Registry.\nmachine us-go.pkg.dev login oauth2accesstoken password \"old token\"\n",
+			wantCreds:  []Credential{{Host: "us-go.pkg.dev", Login: "oauth2accesstoken", Password: "old token"}},
+			wantRemove: "# Work.\nmachine example.com login me password #secret # Not a password.\n# Artifact Registry.\n",
+			wantSet:    "# Work.\nmachine example.com login me password #secret # Not a password.\n# Artifact Registry.\n" + tokenFormat("us-go.pkg.dev", "new"),
+		},
+		{
+			name: "macdef and default",
+			content: "machine ftp.example.com login me password secret\nmacdef init\ncd /pub\n\n" +
+				"machine us-go.pkg.dev login oauth2accesstoken password old\nmacdef init\nbinary\n\n" +
+				"default login anonymous password me@example.com\n",
+			wantCreds: []Credential{{Host: "us-go.pkg.dev", Login: "oauth2accesstoken", Password: "old"}},
+			wantRemove: "machine ftp.example.com login me password secret\nmacdef init\ncd /pub\n\n" +
+				"default login anonymous password me@example.com\n",
+			wantSet: "machine ftp.example.com login me password secret\nmacdef init\ncd /pub\n\n" +
+				tokenFormat("us-go.pkg.dev", "new")[1:] +
+				"default login anonymous password me@example.com\n",
+		},
+		{
+			name:       "unterminated macdef",
+			content:    "machine ftp.example.com\nmacdef init\ncd /pub",
+			wantRemove: "machine ftp.example.com\nmacdef init\ncd /pub",
+			wantSet:    "machine ftp.example.com\nmacdef init\ncd /pub\n" + tokenFormat("us-go.pkg.dev", "new"),
+		},
+		{
+			name:       "not artifact registry",
+			content:    "machine us-go.pkg.dev login me password secret\nmachine example.com login oauth2accesstoken password token\n",
+			wantRemove: "machine us-go.pkg.dev login me password secret\nmachine example.com login oauth2accesstoken password token\n",
+			wantSet:    "machine us-go.pkg.dev login me password secret\nmachine example.com login oauth2accesstoken password token\n" + tokenFormat("us-go.pkg.dev", "new"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			n := &NetRC{content: tc.content}
+			if diff := cmp.Diff(tc.wantCreds, n.Credentials()); diff != "" {
+				t.Errorf("Credentials() (-want,+got):\n%s", diff)
+			}
+
+			n.Remove(nil)
+			if n.content != tc.wantRemove {
+				t.Errorf("Remove() content = %q, want %q", n.content, tc.wantRemove)
+			}
+
+			n = &NetRC{content: tc.content}
+			n.SetToken([]string{"us-go.pkg.dev"}, "new")
+			if n.content != tc.wantSet {
+				t.Errorf("SetToken() content = %q, want %q", n.content, tc.wantSet)
+			}
+		})
+	}
+}
+
+func TestNetRC_Refresh_layouts(t *testing.T) {
+	t.Parallel()
+
+	content := "machine us-go.pkg.dev login oauth2accesstoken password \"old token\"\n" +
+		"machine us-python.pkg.dev login _json_key_base64 password key\n" +
+		"machine example.com login oauth2accesstoken password other\n"
+	want := "machine us-go.pkg.dev login oauth2accesstoken password new\n" +
+		"machine us-python.pkg.dev login _json_key_base64 password key\n" +
+		"machine example.com login oauth2accesstoken password other\n"
+
+	n := &NetRC{content: content}
+	n.Refresh("new")
+	if n.content != want {
+		t.Errorf("Refresh() content = %q, want %q", n.content, want)
+	}
+}
+
+// otherEntries returns the entries that aren't Artifact Registry's.
+func otherEntries(content string) []entry {
+	var entries []entry
+	for _, e := range parse(content).entries {
+		if !e.isArtifactRegistry() {
+			entries = append(entries, entry{machine: e.machine, isDefault: e.isDefault, login: e.login, password: e.password})
+		}
+	}
+	return entries
+}
+
+func FuzzNetRC(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"machine example.com\nlogin me\npassword secret\n\nmachine us-go.pkg.dev\nlogin oauth2accesstoken\npassword token\n",
+		"machine example.com login me password secret machine us-go.pkg.dev login _json_key_base64 password key",
+		"machine us-go.pkg.dev\r\n\tlogin oauth2accesstoken\r\n\tpassword \"a \\\"b\\\"\"\r\n",
+		"# comment\nmachine us-go.pkg.dev login oauth2accesstoken password #token # comment\n",
+		"machine us-go.pkg.dev login oauth2accesstoken password t\nmacdef init\nbinary\n\ndefault login anonymous password me@\n",
+		"macdef init\nmachine us-go.pkg.dev login oauth2accesstoken password t",
+		"machine us-go.pkg.dev login oauth2accesstoken password",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		nf := parse(content)
+		last := 0
+		for _, e := range nf.entries {
+			if e.start < last || e.start >= e.end || e.end > len(content) {
+				t.Fatalf("parse(%q) got entry out of order or range: %+v", content, e)
+			}
+			last = e.end
+		}
+
+		// Nothing to change keeps the content byte for byte.
+		n := &NetRC{content: content}
+		n.Remove([]string{"no-such-host.pkg.dev"})
+		if n.content != content {
+			t.Fatalf("Remove() of unknown host changed %q to %q", content, n.content)
+		}
+
+		others := otherEntries(content)
+
+		n.Remove(nil)
+		if creds := n.Credentials(); len(creds) != 0 {
+			t.Errorf("Remove() of %q left %v", content, creds)
+		}
+		if diff := cmp.Diff(others, otherEntries(n.content), cmp.AllowUnexported(entry{})); diff != "" {
+			t.Errorf("Remove() of %q to %q changed other entries (-want,+got):\n%s", content, n.content, diff)
+		}
+
+		n = &NetRC{content: content}
+		n.Refresh("new")
+		for _, e := range parse(n.content).entries {
+			if e.isArtifactRegistry() && e.login == tokenLogin && e.passwordToken != nil && e.password != "new" {
+				t.Errorf("Refresh() of %q to %q left password %q", content, n.content, e.password)
+			}
+		}
+		if diff := cmp.Diff(others, otherEntries(n.content), cmp.AllowUnexported(entry{})); diff != "" {
+			t.Errorf("Refresh() of %q to %q changed other entries (-want,+got):\n%s", content, n.content, diff)
+		}
+
+		if nf.dangling {
+			// A keyword missing its value takes whatever is added next.
+			return
+		}
+		n = &NetRC{content: content}
+		n.SetToken([]string{"us-go.pkg.dev", "us-python.pkg.dev"}, "new")
+		want := []Credential{
+			{Host: "us-go.pkg.dev", Login: tokenLogin, Password: "new"},
+			{Host: "us-python.pkg.dev", Login: tokenLogin, Password: "new"},
+		}
+		if diff := cmp.Diff(want, n.Credentials()); diff != "" {
+			t.Errorf("SetToken() of %q to %q got credentials (-want,+got):\n%s", content, n.content, diff)
+		}
+		if diff := cmp.Diff(others, otherEntries(n.content), cmp.AllowUnexported(entry{})); diff != "" {
+			t.Errorf("SetToken() of %q to %q changed other entries (-want,+got):\n%s", content, n.content, diff)
+		}
+	})
+}
@@ -0,0 +1,359 @@
+package netrc
+
+import (
+	"strings"
+)
+
+// token is a word of a netrc file with its byte offsets in the content.
+type token struct {
+	value      string
+	start, end int
+}
+
+// entry is a machine or default entry of a netrc file along with its macros.
+type entry struct {
+	machine   string
+	isDefault bool
+	login     string
+	password  string
+	// passwordToken is where the password is, to replace it in place.
+	passwordToken *token
+	// start and end are the byte offsets from the first token of the entry to
+	// the end of its last token or macro.
+	start, end int
+}
+
+func (e *entry) isArtifactRegistry() bool {
+	return !e.isDefault &&
+		strings.HasSuffix(e.machine, ".pkg.dev") &&
+		(e.login == tokenLogin || e.login == jsonKeyLogin)
+}
+
+// file is a parsed netrc file. It only records where the entries are, so the
+// content can be edited in place and everything else is kept byte for byte.
+type file struct {
+	content string
+	entries []*entry
+	// dangling is true if the content ends with a keyword missing its value.
+	dangling bool
+	// openMacro is true if the content ends in a macro that isn't terminated
+	// by an empty line.
+	openMacro bool
+	// secrets are the password and account values, in or out of an entry.
+	secrets []*token
+}
+
+// parse tokenizes the content like ftp(1) and curl do: tokens are separated
+// by whitespace, values may be double-quoted, '#' starts a comment where a
+// keyword is expected, and a macdef body runs until an empty line. Unknown
+// tokens are skipped, so parse never fails.
+func parse(content string) *file {
+	f := &file{content: content}
+	l := &lexer{s: content}
+
+	var cur *entry
+	// value reads the value of a keyword, extending the current entry.
+	value := func() (*token, bool) {
+		v, ok := l.next(true)
+		if !ok {
+			f.dangling = true
+			return nil, false
+		}
+		if cur != nil {
+			cur.end = v.end
+		}
+		return v, true
+	}
+
+	for {
+		tok, ok := l.next(false)
+		if !ok {
+			break
+		}
+
+		switch tok.value {
+		case "machine", "default":
+			cur = &entry{start: tok.start, end: tok.end, isDefault: tok.value == "default"}
+			f.entries = append(f.entries, cur)
+			if cur.isDefault {
+				continue
+			}
+			if v, ok := value(); ok {
+				cur.machine = v.value
+			}
+		case "login", "password", "account":
+			v, ok := value()
+			if !ok {
+				continue
+			}
+			if tok.value != "login" {
+				f.secrets = append(f.secrets, v)
+			}
+			if cur == nil {
+				continue
+			}
+			switch tok.value {
+			case "login":
+				cur.login = v.value
+			case "password":
+				cur.password = v.value
+				cur.passwordToken = v
+			}
+		case "macdef":
+			if _, ok := value(); !ok {
+				continue
+			}
+			if !l.skipMacro() {
+				f.openMacro = true
+			}
+			if cur != nil {
+				cur.end = l.pos
+			}
+		default:
+			if cur != nil {
+				cur.end = tok.end
+			}
+		}
+	}
+	return f
+}
+
+// redact returns the content with the secrets replaced with the mask.
+func (f *file) redact(mask string) string {
+	var sb strings.Builder
+	last := 0
+	for _, t := range f.secrets {
+		sb.WriteString(f.content[last:t.start])
+		sb.WriteString(mask)
+		last = t.end
+	}
+	sb.WriteString(f.content[last:])
+	return sb.String()
+}
+
+// crlf reports whether the file uses CRLF line breaks.
+func (f *file) crlf() bool {
+	return strings.Contains(f.content, "\r\n")
+}
+
+// span returns the byte range to cut to remove the i-th entry. An entry on
+// its own lines takes those lines and a blank line before it; an entry sharing
+// a line with another one takes only its tokens and the spaces before them.
+func (f *file) span(i int) (int, int) {
+	s, e := f.content, f.entries[i]
+
+	// Don't go into the previous entry, e.g. the empty line ending its macro.
+	prevEnd := 0
+	if i > 0 {
+		prevEnd = f.entries[i-1].end
+	}
+
+	j := e.start
+	for j > prevEnd && isSpace(s[j-1]) {
+		j--
+	}
+	start, ownLine := j, false
+	if k := strings.IndexByte(s[j:e.start], '\n'); k >= 0 {
+		// Keep the line break of the previous line.
+		start, ownLine = j+k+1, true
+	} else if j == 0 {
+		ownLine = true
+	}
+
+	end := e.end
+	if ownLine && s[end-1] == '\n' {
+		// The entry ends with a macro. Take the empty line after it unless a
+		// blank line before it is taken already.
+		if !strings.Contains(s[start:e.start], "\n") {
+			if k := strings.IndexByte(s[end:], '\n'); k >= 0 {
+				end += k + 1
+			}
+		}
+	} else if ownLine {
+		k := end
+		for k < len(s) && (s[k] == ' ' || s[k] == '\t' || s[k] == '\r') {
+			k++
+		}
+		if k < len(s) && s[k] == '#' {
+			// A comment at the end of the last line goes with the entry.
+			if i := strings.IndexByte(s[k:], '\n'); i >= 0 {
+				k += i
+			} else {
+				k = len(s)
+			}
+		}
+		switch {
+		case k == len(s):
+			end = k
+		case s[k] == '\n':
+			end = k + 1
+		default:
+			// Another entry follows on the same line.
+			end = k
+		}
+	}
+
+	if start == 0 {
+		// Don't leave blank lines at the top of the file.
+		for k := end; k < len(s) && isSpace(s[k]); k++ {
+			if s[k] == '\n' {
+				end = k + 1
+			}
+		}
+	}
+	return start, end
+}
+
+// remove returns the content without the entries that match.
+func (f *file) remove(match func(*entry) bool) string {
+	var sb strings.Builder
+	last := 0
+	for i, e := range f.entries {
+		if !match(e) {
+			continue
+		}
+		start, end := f.span(i)
+		// Spans of entries on the same line may overlap.
+		start = max(start, last)
+		if start >= end {
+			continue
+		}
+		sb.WriteString(f.content[last:start])
+		last = end
+	}
+	sb.WriteString(f.content[last:])
+	return sb.String()
+}
+
+// insert returns the content with the text added before the default entry,
+// which must be the last one, or at the end.
+func (f *file) insert(text string) string {
+	if text == "" {
+		return f.content
+	}
+	if f.crlf() {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+
+	at := len(f.content)
+	for i, e := range f.entries {
+		if e.isDefault {
+			at, _ = f.span(i)
+			break
+		}
+	}
+
+	before, after := f.content[:at], f.content[at:]
+	if at == len(f.content) && f.openMacro && !strings.HasSuffix(before, "\n") {
+		// The macro ends at an empty line, which the text must not be part of.
+		before += "\n"
+	}
+	if before == "" || strings.HasSuffix(before, "\n\n") || strings.HasSuffix(before, "\r\n\r\n") {
+		// There is a blank line already.
+		text = strings.TrimPrefix(strings.TrimPrefix(text, "\r"), "\n")
+	}
+	return before + text + after
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	}
+	return false
+}
+
+func isLineBreak(c byte) bool {
+	return c == '\n' || c == '\r'
+}
+
+// lexer splits the content of a netrc file into tokens.
+type lexer struct {
+	s   string
+	pos int
+}
+
+// next returns the next token, or false at the end of the content. Where a
+// keyword is expected, comments are skipped; a value may start with '#'.
+func (l *lexer) next(isValue bool) (*token, bool) {
+	for {
+		for l.pos < len(l.s) && isSpace(l.s[l.pos]) {
+			l.pos++
+		}
+		if l.pos >= len(l.s) {
+			return nil, false
+		}
+		if isValue || l.s[l.pos] != '#' {
+			break
+		}
+		if i := strings.IndexByte(l.s[l.pos:], '\n'); i >= 0 {
+			l.pos += i
+		} else {
+			l.pos = len(l.s)
+		}
+	}
+
+	start := l.pos
+	if l.s[l.pos] != '"' {
+		for l.pos < len(l.s) && !isSpace(l.s[l.pos]) {
+			l.pos++
+		}
+		return &token{value: l.s[start:l.pos], start: start, end: l.pos}, true
+	}
+
+	// A quoted value ends at the closing quote, or at the end of the line if
+	// it's missing. Like in a shell, anything right after the closing quote is
+	// still part of the token.
+	var sb strings.Builder
+	l.pos++
+	for l.pos < len(l.s) && l.s[l.pos] != '"' && !isLineBreak(l.s[l.pos]) {
+		c := l.s[l.pos]
+		if c == '\\' && l.pos+1 < len(l.s) && !isLineBreak(l.s[l.pos+1]) {
+			l.pos++
+			c = l.s[l.pos]
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			}
+		}
+		sb.WriteByte(c)
+		l.pos++
+	}
+	if l.pos < len(l.s) && l.s[l.pos] == '"' {
+		l.pos++
+		for l.pos < len(l.s) && !isSpace(l.s[l.pos]) {
+			sb.WriteByte(l.s[l.pos])
+			l.pos++
+		}
+	}
+	return &token{value: sb.String(), start: start, end: l.pos}, true
+}
+
+// skipMacro skips the rest of the macdef line and the macro body, which ends
+// at an empty line. It stops before the empty line, and returns false if the
+// content ends first.
+func (l *lexer) skipMacro() bool {
+	i := strings.IndexByte(l.s[l.pos:], '\n')
+	if i < 0 {
+		l.pos = len(l.s)
+		return false
+	}
+	l.pos += i + 1
+
+	for l.pos < len(l.s) {
+		i := strings.IndexByte(l.s[l.pos:], '\n')
+		if i < 0 {
+			l.pos = len(l.s)
+			return false
+		}
+		if strings.TrimSuffix(l.s[l.pos:l.pos+i], "\r") == "" {
+			return true
+		}
+		l.pos += i + 1
+	}
+	return false
+}
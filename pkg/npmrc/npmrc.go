@@ -2,30 +2,77 @@
 package npmrc
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/atomicfile"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/filelock"
 )
 
+// Credential is the credential of an Artifact Registry repo in an npmrc file.
+type Credential struct {
+	// Registry is the repo URL without scheme, e.g. //us-npm.pkg.dev/my-project/repo1/.
+	Registry string
+	Username string
+	Password string
+}
+
 type Config struct {
 	npmrcPath string
 	scope     string
+	original  []byte
 	content   *bytes.Buffer
+	lock      *filelock.Lock
 }
 
+// Open reads the npmrc file without locking it. Use OpenLocked to update the
+// file.
 func Open(npmrcPath, scope string) (*Config, error) {
-	if npmrcPath == "" {
-		h, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("cannot find HOME dir: %w", err)
-		}
-		npmrcPath = filepath.Join(h, ".npmrc")
+	npmrcPath, err := resolvePath(npmrcPath)
+	if err != nil {
+		return nil, err
+	}
+	return read(npmrcPath, scope)
+}
+
+// OpenLocked is like Open, but holds an exclusive lock on the file until
+// Close or Discard, so concurrent updates from other processes don't lose
+// each other's changes.
+func OpenLocked(npmrcPath, scope string) (*Config, error) {
+	npmrcPath, err := resolvePath(npmrcPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := filelock.Acquire(npmrcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %q: %w", npmrcPath, err)
+	}
+	c, err := read(npmrcPath, scope)
+	if err != nil {
+		return nil, errors.Join(err, lock.Release())
+	}
+	c.lock = lock
+	return c, nil
+}
+
+func resolvePath(npmrcPath string) (string, error) {
+	if npmrcPath != "" {
+		return npmrcPath, nil
+	}
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find HOME dir: %w", err)
 	}
+	return filepath.Join(h, ".npmrc"), nil
+}
 
+func read(npmrcPath, scope string) (*Config, error) {
 	b, err := os.ReadFile(npmrcPath)
 	if os.IsNotExist(err) {
 		return &Config{npmrcPath: npmrcPath, scope: scope, content: &bytes.Buffer{}}, nil
@@ -34,7 +81,22 @@ func Open(npmrcPath, scope string) (*Config, error) {
 		return nil, fmt.Errorf("cannot load file %q: %v", npmrcPath, err)
 	}
 
-	return &Config{npmrcPath: npmrcPath, scope: scope, content: bytes.NewBuffer(b)}, nil
+	return &Config{npmrcPath: npmrcPath, scope: scope, original: bytes.Clone(b), content: bytes.NewBuffer(b)}, nil
+}
+
+// Path returns the path of the npmrc file.
+func (c *Config) Path() string {
+	return c.npmrcPath
+}
+
+// Original returns the content of the file when opened.
+func (c *Config) Original() []byte {
+	return c.original
+}
+
+// Marshal returns the content Close writes.
+func (c *Config) Marshal() ([]byte, error) {
+	return bytes.Clone(c.content.Bytes()), nil
 }
 
 func (c *Config) SetToken(repos []string, token string) {
@@ -45,26 +107,103 @@ func (c *Config) SetJSONKey(repos []string, base64Key string) {
 	c.update(repos, "_json_key_base64", base64Key)
 }
 
-func (c *Config) Close() error {
+// Close writes the file and releases the lock if any.
+func (c *Config) Close() (retErr error) {
+	defer func() {
+		retErr = errors.Join(retErr, c.Discard())
+	}()
+
 	// Make sure dir exists.
 	if err := os.MkdirAll(filepath.Dir(c.npmrcPath), 0755); err != nil {
 		return fmt.Errorf("failed to create dir for %q: %w", c.npmrcPath, err)
 	}
 
-	f, err := os.OpenFile(c.npmrcPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0777)
-	if err != nil {
-		return fmt.Errorf("failed to open %q: %w", c.npmrcPath, err)
-	}
-	defer f.Close()
-
-	if _, err := f.Write(c.content.Bytes()); err != nil {
+	if err := atomicfile.Write(c.npmrcPath, c.content.Bytes()); err != nil {
 		return fmt.Errorf("failed to save %q: %w", c.npmrcPath, err)
 	}
 	return nil
 }
 
+// Discard releases the lock if any without writing the file.
+func (c *Config) Discard() error {
+	return c.lock.Release()
+}
+
+// Remove removes the registry lines and credentials of the given repos, or of
+// all Artifact Registry repos if no repo is given. Other lines are left intact.
+func (c *Config) Remove(repos []string) {
+	wanted := make(map[string]struct{}, len(repos))
+	for _, repo := range repos {
+		wanted[normalizeRepoURL(repo)] = struct{}{}
+	}
+	matches := func(url string) bool {
+		if len(repos) == 0 {
+			host, _, _ := strings.Cut(strings.TrimPrefix(url, "https://"), "/")
+			return strings.HasSuffix(host, ".pkg.dev")
+		}
+		_, ok := wanted[url]
+		return ok
+	}
+
+	var lines []string
+	for _, line := range splitLines(c.content.String()) {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case !ok:
+		case key == "registry" || (strings.HasPrefix(key, "@") && strings.HasSuffix(key, ":registry")):
+			// The registry line, e.g. @scope:registry=https://us-npm.pkg.dev/my-project/repo1/
+			if matches(normalizeRepoURL(value)) {
+				continue
+			}
+		case strings.HasPrefix(key, "//"):
+			// The per-registry lines, e.g. //us-npm.pkg.dev/my-project/repo1/:_authToken=...
+			if i := strings.LastIndex(key, ":"); i > 0 && matches(normalizeRepoURL("https:"+key[:i])) {
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		c.content = &bytes.Buffer{}
+		return
+	}
+	c.content = bytes.NewBufferString(strings.Join(lines, "\n") + "\n")
+}
+
+// Credentials returns the credentials of Artifact Registry repos in order.
+// Auth tokens that are not in the format written by SetToken and SetJSONKey
+// are skipped.
+func (c *Config) Credentials() []Credential {
+	var creds []Credential
+	for _, line := range strings.Split(c.content.String(), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		registry, ok := strings.CutSuffix(strings.TrimSpace(key), ":_authToken")
+		if !ok || !strings.HasPrefix(registry, "//") {
+			continue
+		}
+		host, _, _ := strings.Cut(strings.TrimPrefix(registry, "//"), "/")
+		if !strings.HasSuffix(host, ".pkg.dev") {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		user, pwd, ok := strings.Cut(string(b), ":")
+		if !ok {
+			continue
+		}
+		creds = append(creds, Credential{Registry: registry, Username: user, Password: pwd})
+	}
+	return creds
+}
+
 func (c *Config) update(repos []string, user, pwd string) {
-	scanner := bufio.NewScanner(c.content)
 	var lines []string
 
 	// For each registry, we need 4 lines config:
@@ -77,8 +216,8 @@ func (c *Config) update(repos []string, user, pwd string) {
 	existingAuth := map[string]struct{}{}
 	existingEmails := map[string]struct{}{}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	for _, line := range splitLines(c.content.String()) {
+		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
 			lines = append(lines, line)
 			continue
@@ -126,10 +265,6 @@ func (c *Config) update(repos []string, user, pwd string) {
 		lines = append(lines, newLine)
 	}
 
-	if err := scanner.Err(); err != nil {
-		panic(err) // Really shouldn't happen.
-	}
-
 	// Add missing registries.
 	for _, repo := range repos {
 		url := normalizeRepoURL(repo)
@@ -157,6 +292,19 @@ func (c *Config) update(repos []string, user, pwd string) {
 	c.content = bytes.NewBufferString(strings.Join(lines, "\n") + "\n")
 }
 
+// splitLines splits the content into lines like bufio.ScanLines, but without
+// its limit on the line length, which a valid npmrc file may exceed.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
 func (c *Config) registryKey() string {
 	if c.scope == "" {
 		return "registry"
@@ -1,6 +1,7 @@
 package npmrc
 
 import (
+	"bytes"
 	"encoding/base64"
 	"os"
 	"path/filepath"
@@ -187,3 +188,74 @@ func TestCloseWritesFile(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	t.Parallel()
+
+	content := `# comment
+registry=https://registry.npmjs.org/
+//registry.npmjs.org/:_authToken=npm-token
+@scope1:registry=https://us-npm.pkg.dev/my-project/repo1/
+//us-npm.pkg.dev/my-project/repo1/:always-auth=true
+//us-npm.pkg.dev/my-project/repo1/:_authToken=token1
+@scope2:registry=https://us-npm.pkg.dev/my-project/repo2/
+//us-npm.pkg.dev/my-project/repo2/:_authToken=token2
+`
+
+	tests := []struct {
+		name  string
+		repos []string
+		want  string
+	}{
+		{
+			name:  "given repos",
+			repos: []string{"us-npm.pkg.dev/my-project/repo1"},
+			want: `# comment
+registry=https://registry.npmjs.org/
+//registry.npmjs.org/:_authToken=npm-token
+@scope2:registry=https://us-npm.pkg.dev/my-project/repo2/
+//us-npm.pkg.dev/my-project/repo2/:_authToken=token2
+`,
+		},
+		{
+			name: "all repos",
+			want: `# comment
+registry=https://registry.npmjs.org/
+//registry.npmjs.org/:_authToken=npm-token
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &Config{content: bytes.NewBufferString(content)}
+			cfg.Remove(tc.repos)
+			if got := cfg.content.String(); got != tc.want {
+				t.Errorf("Remove() content = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLongLine(t *testing.T) {
+	t.Parallel()
+
+	// Longer than the 64 KiB limit of bufio.Scanner.
+	long := "# " + strings.Repeat("x", 100*1024)
+	content := long + "\n" +
+		"@scope1:registry=https://us-npm.pkg.dev/my-project/repo1/\n" +
+		"//us-npm.pkg.dev/my-project/repo1/:_authToken=token1\n"
+
+	cfg := &Config{scope: "scope1", content: bytes.NewBufferString(content)}
+	cfg.SetToken([]string{"us-npm.pkg.dev/my-project/repo1"}, "new-token")
+	if got := cfg.content.String(); !strings.HasPrefix(got, long+"\n") || strings.Contains(got, "token1") {
+		t.Errorf("SetToken() content = %.100q..., want the long line kept and the token replaced", got)
+	}
+
+	cfg.Remove(nil)
+	if got, want := cfg.content.String(), long+"\n"; got != want {
+		t.Errorf("Remove() content = %.100q..., want only the long line", got)
+	}
+}
@@ -0,0 +1,292 @@
+// Package pip provides functions to modify a pip.conf file.
+package pip
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/atomicfile"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/filelock"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/ini"
+)
+
+const globalSection = "global"
+
+// FileName returns the name of the pip config file on the current platform.
+func FileName() string {
+	if runtime.GOOS == "windows" {
+		return "pip.ini"
+	}
+	return "pip.conf"
+}
+
+// IndexURL returns the simple index URL of a Python repo.
+//
+// Given repo: us-python.pkg.dev/my-project/my-repo
+// Index URL: https://us-python.pkg.dev/my-project/my-repo/simple/
+func IndexURL(repo string) string {
+	if !strings.HasPrefix(repo, "https://") {
+		repo = "https://" + repo
+	}
+	repo = strings.TrimSuffix(repo, "/")
+	repo = strings.TrimSuffix(repo, "/simple")
+	return repo + "/simple/"
+}
+
+type Config struct {
+	path     string
+	original []byte
+	file     *ini.File
+	lock     *filelock.Lock
+}
+
+// Open loads the pip config file without locking it. If the path is empty,
+// the per-user config file is used, e.g. ~/.config/pip/pip.conf on Linux. Use
+// OpenLocked to update the file.
+func Open(confPath string) (*Config, error) {
+	confPath, err := resolvePath(confPath)
+	if err != nil {
+		return nil, err
+	}
+	return read(confPath)
+}
+
+// OpenLocked is like Open, but holds an exclusive lock on the file until
+// Close or Discard, so concurrent updates from other processes don't lose
+// each other's changes.
+func OpenLocked(confPath string) (*Config, error) {
+	confPath, err := resolvePath(confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := filelock.Acquire(confPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %q: %w", confPath, err)
+	}
+	c, err := read(confPath)
+	if err != nil {
+		return nil, errors.Join(err, lock.Release())
+	}
+	c.lock = lock
+	return c, nil
+}
+
+func resolvePath(confPath string) (string, error) {
+	if confPath != "" {
+		return confPath, nil
+	}
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find user config dir: %w", err)
+	}
+	return filepath.Join(d, "pip", FileName()), nil
+}
+
+func read(confPath string) (*Config, error) {
+	data, err := os.ReadFile(confPath)
+	if os.IsNotExist(err) {
+		return &Config{path: confPath, file: &ini.File{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load file %q: %v", confPath, err)
+	}
+	return &Config{path: confPath, original: data, file: ini.Parse(data)}, nil
+}
+
+func (c *Config) SetToken(repos []string, token string) {
+	c.update(repos, "oauth2accesstoken", token)
+}
+
+func (c *Config) SetJSONKey(repos []string, base64Key string) {
+	c.update(repos, "_json_key_base64", base64Key)
+}
+
+// Close writes the file and releases the lock if any.
+func (c *Config) Close() (retErr error) {
+	defer func() {
+		retErr = errors.Join(retErr, c.Discard())
+	}()
+
+	// Make sure dir exists.
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for %q: %w", c.path, err)
+	}
+
+	if err := atomicfile.Write(c.path, []byte(c.String())); err != nil {
+		return fmt.Errorf("failed to save %q: %w", c.path, err)
+	}
+	return nil
+}
+
+// Discard releases the lock if any without writing the file.
+func (c *Config) Discard() error {
+	return c.lock.Release()
+}
+
+// Path returns the path of the pip.conf file.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Original returns the content of the file when opened.
+func (c *Config) Original() []byte {
+	return c.original
+}
+
+// Marshal returns the content Close writes.
+func (c *Config) Marshal() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// String returns the content of the config file.
+func (c *Config) String() string {
+	return c.file.String()
+}
+
+func (c *Config) update(repos []string, user, pwd string) {
+	start, end := c.file.Section(globalSection)
+	if start < 0 {
+		start, end = c.file.AddSection(globalSection)
+	}
+
+	var index, extra *ini.Option
+	for _, o := range c.file.Options(start+1, end) {
+		// pip accepts "index_url" style keys as well.
+		switch strings.ReplaceAll(strings.TrimPrefix(o.Key, "--"), "_", "-") {
+		case "index-url":
+			index = o
+		case "extra-index-url":
+			extra = o
+		}
+	}
+
+	// The index URLs without credentials that we are going to set.
+	wanted := make(map[string]string, len(repos))
+	for _, r := range repos {
+		wanted[IndexURL(r)] = withCredential(IndexURL(r), user, pwd)
+	}
+	handled := map[string]struct{}{}
+
+	var indexValue string
+	if index != nil && len(index.Values) > 0 {
+		indexValue = index.Values[0]
+		if k := stripCredential(indexValue); wanted[k] != "" {
+			indexValue = wanted[k]
+			handled[k] = struct{}{}
+		}
+	}
+
+	var extraValues []string
+	if extra != nil {
+		for _, v := range extra.Values {
+			k := stripCredential(v)
+			if _, ok := handled[k]; ok {
+				continue // Drop duplicates.
+			}
+			if wanted[k] != "" {
+				v = wanted[k]
+				handled[k] = struct{}{}
+			}
+			extraValues = append(extraValues, v)
+		}
+	}
+
+	for _, r := range repos {
+		k := IndexURL(r)
+		if _, ok := handled[k]; ok {
+			continue
+		}
+		handled[k] = struct{}{}
+		if indexValue == "" {
+			indexValue = wanted[k]
+			continue
+		}
+		extraValues = append(extraValues, wanted[k])
+	}
+
+	// Replace from the bottom up so that the line indexes stay valid.
+	extraLines := ini.FormatOption("extra-index-url", extraValues)
+	indexLines := ini.FormatOption("index-url", []string{indexValue})
+	switch {
+	case index != nil && extra != nil && extra.Start > index.Start:
+		c.file.Splice(extra.Start, extra.End, extraLines)
+		c.file.Splice(index.Start, index.End, indexLines)
+	case index != nil && extra != nil:
+		c.file.Splice(index.Start, index.End, indexLines)
+		c.file.Splice(extra.Start, extra.End, extraLines)
+	case index != nil:
+		c.file.Splice(index.End, index.End, extraLines)
+		c.file.Splice(index.Start, index.End, indexLines)
+	case extra != nil:
+		c.file.Splice(extra.Start, extra.End, append(indexLines, extraLines...))
+	default:
+		c.file.Splice(start+1, start+1, append(indexLines, extraLines...))
+	}
+}
+
+// Remove removes the index URLs of the given repos, or of all Artifact
+// Registry repos if no repo is given. Other index URLs are left intact.
+func (c *Config) Remove(repos []string) {
+	start, end := c.file.Section(globalSection)
+	if start < 0 {
+		return
+	}
+
+	wanted := make(map[string]struct{}, len(repos))
+	for _, r := range repos {
+		wanted[IndexURL(r)] = struct{}{}
+	}
+	matches := func(v string) bool {
+		k := stripCredential(v)
+		if len(repos) == 0 {
+			u, err := url.Parse(k)
+			return err == nil && strings.HasSuffix(u.Hostname(), ".pkg.dev")
+		}
+		_, ok := wanted[k]
+		return ok
+	}
+
+	opts := c.file.Options(start+1, end)
+	// Replace from the bottom up so that the line indexes stay valid.
+	for i := len(opts) - 1; i >= 0; i-- {
+		o := opts[i]
+		switch strings.ReplaceAll(strings.TrimPrefix(o.Key, "--"), "_", "-") {
+		case "index-url", "extra-index-url":
+		default:
+			continue
+		}
+		var values []string
+		for _, v := range o.Values {
+			if !matches(v) {
+				values = append(values, v)
+			}
+		}
+		if len(values) != len(o.Values) {
+			c.file.Splice(o.Start, o.End, ini.FormatOption(o.Key, values))
+		}
+	}
+}
+
+func withCredential(indexURL, user, pwd string) string {
+	u, err := url.Parse(indexURL)
+	if err != nil {
+		return indexURL
+	}
+	u.User = url.UserPassword(user, pwd)
+	return u.String()
+}
+
+func stripCredential(indexURL string) string {
+	u, err := url.Parse(indexURL)
+	if err != nil {
+		return indexURL
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,240 @@
+// Package pypirc provides functions to modify a .pypirc file.
+package pypirc
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/atomicfile"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/filelock"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/internal/ini"
+	"github.com/yolocs/artifact-registry-cred-helper/pkg/maven"
+)
+
+const distutilsSection = "distutils"
+
+// DefaultRepoID is our default way to construct the index server name used
+// with `twine upload --repository`, the same as maven.DefaultRepoID.
+//
+// Given repo URL: us-python.pkg.dev/my-project/my-repo
+// Default repo ID: artifactregistry-my-project-my-repo
+func DefaultRepoID(repoURL *url.URL) string {
+	return maven.DefaultRepoID(repoURL)
+}
+
+// RepositoryURL returns the upload URL of a Python repo.
+//
+// Given repo: us-python.pkg.dev/my-project/my-repo
+// Repository URL: https://us-python.pkg.dev/my-project/my-repo/
+func RepositoryURL(repo string) string {
+	if !strings.HasPrefix(repo, "https://") {
+		repo = "https://" + repo
+	}
+	return strings.TrimSuffix(repo, "/") + "/"
+}
+
+type Config struct {
+	path     string
+	repoIDs  map[string]string
+	original []byte
+	file     *ini.File
+	lock     *filelock.Lock
+}
+
+// Open loads the .pypirc file without locking it. If the path is empty,
+// ~/.pypirc is used. Use OpenLocked to update the file.
+//
+// The repoIDs maps a repo (e.g. us-python.pkg.dev/my-project/my-repo) to the
+// index server name to use for it. Repos not in the map use DefaultRepoID.
+func Open(pypircPath string, repoIDs map[string]string) (*Config, error) {
+	pypircPath, err := resolvePath(pypircPath)
+	if err != nil {
+		return nil, err
+	}
+	return read(pypircPath, repoIDs)
+}
+
+// OpenLocked is like Open, but holds an exclusive lock on the file until
+// Close or Discard, so concurrent updates from other processes don't lose
+// each other's changes.
+func OpenLocked(pypircPath string, repoIDs map[string]string) (*Config, error) {
+	pypircPath, err := resolvePath(pypircPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := filelock.Acquire(pypircPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %q: %w", pypircPath, err)
+	}
+	c, err := read(pypircPath, repoIDs)
+	if err != nil {
+		return nil, errors.Join(err, lock.Release())
+	}
+	c.lock = lock
+	return c, nil
+}
+
+func resolvePath(pypircPath string) (string, error) {
+	if pypircPath != "" {
+		return pypircPath, nil
+	}
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find HOME dir: %w", err)
+	}
+	return filepath.Join(h, ".pypirc"), nil
+}
+
+func read(pypircPath string, repoIDs map[string]string) (*Config, error) {
+	data, err := os.ReadFile(pypircPath)
+	if os.IsNotExist(err) {
+		return &Config{path: pypircPath, repoIDs: repoIDs, file: &ini.File{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load file %q: %v", pypircPath, err)
+	}
+	return &Config{path: pypircPath, repoIDs: repoIDs, original: data, file: ini.Parse(data)}, nil
+}
+
+func (c *Config) SetToken(repos []string, token string) {
+	c.update(repos, "oauth2accesstoken", token)
+}
+
+func (c *Config) SetJSONKey(repos []string, base64Key string) {
+	c.update(repos, "_json_key_base64", base64Key)
+}
+
+// Close writes the file and releases the lock if any.
+func (c *Config) Close() (retErr error) {
+	defer func() {
+		retErr = errors.Join(retErr, c.Discard())
+	}()
+
+	// Make sure dir exists.
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for %q: %w", c.path, err)
+	}
+
+	if err := atomicfile.Write(c.path, []byte(c.String())); err != nil {
+		return fmt.Errorf("failed to save %q: %w", c.path, err)
+	}
+	return nil
+}
+
+// Discard releases the lock if any without writing the file.
+func (c *Config) Discard() error {
+	return c.lock.Release()
+}
+
+// Path returns the path of the .pypirc file.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Original returns the content of the file when opened.
+func (c *Config) Original() []byte {
+	return c.original
+}
+
+// Marshal returns the content Close writes.
+func (c *Config) Marshal() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// String returns the content of the .pypirc file.
+func (c *Config) String() string {
+	return c.file.String()
+}
+
+func (c *Config) repoID(repo string) string {
+	if id := c.repoIDs[repo]; id != "" {
+		return id
+	}
+	u, err := url.Parse(RepositoryURL(repo))
+	if err != nil {
+		return "artifactregistry-" + repo
+	}
+	return DefaultRepoID(u)
+}
+
+func (c *Config) update(repos []string, user, pwd string) {
+	var servers []string
+	if start, end := c.file.Section(distutilsSection); start >= 0 {
+		if o := c.file.Option(start+1, end, "index-servers"); o != nil {
+			servers = o.Values
+		}
+	}
+	existing := make(map[string]struct{}, len(servers))
+	for _, s := range servers {
+		existing[s] = struct{}{}
+	}
+
+	for _, repo := range repos {
+		id := c.repoID(repo)
+		if _, ok := existing[id]; !ok {
+			servers = append(servers, id)
+			existing[id] = struct{}{}
+		}
+		c.file.Set(id, "repository", []string{RepositoryURL(repo)})
+		c.file.Set(id, "username", []string{user})
+		c.file.Set(id, "password", []string{pwd})
+	}
+
+	if start, _ := c.file.Section(distutilsSection); start < 0 {
+		// The distutils section conventionally comes first.
+		lines := append([]string{"[" + distutilsSection + "]"}, ini.FormatOption("index-servers", servers)...)
+		lines = append(lines, "")
+		c.file.Splice(0, 0, lines)
+		return
+	}
+	c.file.Set(distutilsSection, "index-servers", servers)
+}
+
+// Remove removes the index servers of the given repos, or of all Artifact
+// Registry repos if no repo is given. Other index servers are left intact.
+func (c *Config) Remove(repos []string) {
+	ids := map[string]struct{}{}
+	if len(repos) > 0 {
+		for _, repo := range repos {
+			ids[c.repoID(repo)] = struct{}{}
+		}
+	} else {
+		for _, name := range c.file.Sections() {
+			start, end := c.file.Section(name)
+			o := c.file.Option(start+1, end, "repository")
+			if o == nil || len(o.Values) == 0 {
+				continue
+			}
+			if u, err := url.Parse(o.Values[0]); err == nil && strings.HasSuffix(u.Hostname(), ".pkg.dev") {
+				ids[name] = struct{}{}
+			}
+		}
+	}
+
+	for id := range ids {
+		c.file.RemoveSection(id)
+	}
+
+	start, end := c.file.Section(distutilsSection)
+	if start < 0 {
+		return
+	}
+	o := c.file.Option(start+1, end, "index-servers")
+	if o == nil {
+		return
+	}
+	var servers []string
+	for _, s := range o.Values {
+		if _, ok := ids[s]; !ok {
+			servers = append(servers, s)
+		}
+	}
+	if len(servers) != len(o.Values) {
+		c.file.Set(distutilsSection, "index-servers", servers)
+	}
+}
@@ -0,0 +1,240 @@
+package pypirc
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDefaultRepoID(t *testing.T) {
+	t.Parallel()
+
+	u, err := url.Parse("https://us-python.pkg.dev/my-project/my-repo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := DefaultRepoID(u), "artifactregistry-my-project-my-repo"; got != want {
+		t.Errorf("DefaultRepoID() = %q, want %q", got, want)
+	}
+}
+
+func TestConfig_update(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		repoIDs map[string]string
+		repos   []string
+		want    string
+	}{
+		{
+			name:  "empty_file",
+			repos: []string{"us-python.pkg.dev/proj/repo1", "us-python.pkg.dev/proj/repo2"},
+			want: `[distutils]
+index-servers =
+    artifactregistry-proj-repo1
+    artifactregistry-proj-repo2
+
+[artifactregistry-proj-repo1]
+repository = https://us-python.pkg.dev/proj/repo1/
+username = oauth2accesstoken
+password = token
+
+[artifactregistry-proj-repo2]
+repository = https://us-python.pkg.dev/proj/repo2/
+username = oauth2accesstoken
+password = token
+`,
+		},
+		{
+			name: "keep_other_servers",
+			content: `[distutils]
+index-servers =
+    pypi
+
+# The public index.
+[pypi]
+username = __token__
+password = pypi-token
+`,
+			repos: []string{"us-python.pkg.dev/proj/repo1"},
+			want: `[distutils]
+index-servers =
+    pypi
+    artifactregistry-proj-repo1
+
+# The public index.
+[pypi]
+username = __token__
+password = pypi-token
+
+[artifactregistry-proj-repo1]
+repository = https://us-python.pkg.dev/proj/repo1/
+username = oauth2accesstoken
+password = token
+`,
+		},
+		{
+			name: "update_in_place",
+			content: `[distutils]
+index-servers = my-repo pypi
+
+[my-repo]
+repository = https://us-python.pkg.dev/proj/repo1/
+username = _json_key_base64
+password = old
+
+[pypi]
+username = __token__
+`,
+			repoIDs: map[string]string{"us-python.pkg.dev/proj/repo1": "my-repo"},
+			repos:   []string{"us-python.pkg.dev/proj/repo1"},
+			want: `[distutils]
+index-servers =
+    my-repo
+    pypi
+
+[my-repo]
+repository = https://us-python.pkg.dev/proj/repo1/
+username = oauth2accesstoken
+password = token
+
+[pypi]
+username = __token__
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), ".pypirc")
+			if tc.content != "" {
+				if err := os.WriteFile(p, []byte(tc.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := Open(p, tc.repoIDs)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			c.SetToken(tc.repos, "token")
+			if diff := cmp.Diff(tc.want, c.String()); diff != "" {
+				t.Errorf("SetToken() content (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConfig_Remove(t *testing.T) {
+	t.Parallel()
+
+	content := `[distutils]
+index-servers =
+    pypi
+    artifactregistry-proj-repo1
+    my-repo
+
+[pypi]
+username = __token__
+
+[artifactregistry-proj-repo1]
+repository = https://us-python.pkg.dev/proj/repo1/
+username = oauth2accesstoken
+password = token
+
+[my-repo]
+repository = https://us-python.pkg.dev/proj/repo2/
+username = oauth2accesstoken
+password = token
+`
+
+	tests := []struct {
+		name    string
+		repoIDs map[string]string
+		repos   []string
+		want    string
+	}{
+		{
+			name:    "given_repo",
+			repoIDs: map[string]string{"us-python.pkg.dev/proj/repo2": "my-repo"},
+			repos:   []string{"us-python.pkg.dev/proj/repo2"},
+			want: `[distutils]
+index-servers =
+    pypi
+    artifactregistry-proj-repo1
+
+[pypi]
+username = __token__
+
+[artifactregistry-proj-repo1]
+repository = https://us-python.pkg.dev/proj/repo1/
+username = oauth2accesstoken
+password = token
+`,
+		},
+		{
+			name: "all_repos",
+			want: `[distutils]
+index-servers = pypi
+
+[pypi]
+username = __token__
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), ".pypirc")
+			if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c, err := Open(p, tc.repoIDs)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			c.Remove(tc.repos)
+			if diff := cmp.Diff(tc.want, c.String()); diff != "" {
+				t.Errorf("Remove() content (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConfig_Close(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "subdir", ".pypirc")
+	c, err := Open(p, nil)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	c.SetJSONKey([]string{"us-python.pkg.dev/proj/repo1"}, "key")
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	want := `[distutils]
+index-servers = artifactregistry-proj-repo1
+
+[artifactregistry-proj-repo1]
+repository = https://us-python.pkg.dev/proj/repo1/
+username = _json_key_base64
+password = key
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Close() wrote (-want,+got):\n%s", diff)
+	}
+}
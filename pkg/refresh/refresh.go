@@ -0,0 +1,174 @@
+// Package refresh schedules credential refreshes based on when the credential
+// expires.
+package refresh
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultFraction is the default fraction of the remaining lifetime to wait
+	// before refreshing.
+	DefaultFraction = 0.5
+
+	// MinInterval is the minimum interval between refreshes when the expiry is
+	// unknown.
+	MinInterval = 2 * time.Minute
+
+	defaultJitter         = 0.1
+	defaultMaxRetries     = 5
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+
+	// minDelay prevents refreshing in a tight loop when the credential is about
+	// to expire or already expired.
+	minDelay = 10 * time.Second
+)
+
+// ValidateInterval returns an error if the interval is less than MinInterval.
+func ValidateInterval(interval time.Duration) error {
+	if interval < MinInterval {
+		return fmt.Errorf("refresh interval must be at least %v", MinInterval)
+	}
+	return nil
+}
+
+// ValidateFraction returns an error if the fraction is not in [0, 1), where 0
+// means DefaultFraction.
+func ValidateFraction(fraction float64) error {
+	if fraction < 0 || fraction >= 1 {
+		return fmt.Errorf("refresh fraction must be at least 0 and less than 1, got %v", fraction)
+	}
+	return nil
+}
+
+// Scheduler refreshes a credential at a fraction of its remaining lifetime,
+// and retries failed refreshes with exponential backoff.
+type Scheduler struct {
+	// Interval is the delay between refreshes when the expiry of the credential
+	// is unknown, e.g. a JSON key or a token from an env var.
+	Interval time.Duration
+
+	// Fraction of the remaining lifetime to wait before refreshing. Default to
+	// DefaultFraction.
+	Fraction float64
+
+	// Jitter is the maximum fraction of the delay to randomly add or subtract.
+	// Default to 0.1.
+	Jitter float64
+
+	// MaxRetries is how many times a failed refresh is retried before giving
+	// up. Default to 5.
+	MaxRetries int
+
+	// InitialBackoff is the delay before the first retry, which doubles for
+	// each retry up to a minute. Default to 1s.
+	InitialBackoff time.Duration
+
+	now   func() time.Time
+	rand  func() float64
+	after func(time.Duration) <-chan time.Time
+}
+
+// Run calls refresh before the credential expires until the context is done.
+// The expiry is when the current credential expires, and refresh returns the
+// expiry of the new one. A zero expiry means unknown.
+//
+// Run returns ctx.Err() when the context is done, or the last error of refresh
+// once the retries are exhausted.
+func (s *Scheduler) Run(ctx context.Context, expiry time.Time, refresh func(context.Context) (time.Time, error)) error {
+	for {
+		if err := s.wait(ctx, s.Next(expiry)); err != nil {
+			return err
+		}
+
+		var err error
+		for attempt := 0; ; attempt++ {
+			expiry, err = refresh(ctx)
+			if err == nil {
+				break
+			}
+			if attempt >= s.maxRetries() {
+				return fmt.Errorf("giving up after %d retries: %w", attempt, err)
+			}
+			if err := s.wait(ctx, s.backoff(attempt)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Next returns the delay before refreshing a credential that expires at the
+// given time.
+func (s *Scheduler) Next(expiry time.Time) time.Duration {
+	d := s.Interval
+	if !expiry.IsZero() {
+		fraction := s.Fraction
+		if fraction <= 0 {
+			fraction = DefaultFraction
+		}
+		d = time.Duration(float64(expiry.Sub(s.nowFunc())) * fraction)
+	}
+
+	jitter := s.Jitter
+	if jitter <= 0 {
+		jitter = defaultJitter
+	}
+	d += time.Duration(float64(d) * jitter * (2*s.randFunc() - 1))
+
+	if d < minDelay {
+		d = minDelay
+	}
+	return d
+}
+
+func (s *Scheduler) backoff(attempt int) time.Duration {
+	d := s.InitialBackoff
+	if d <= 0 {
+		d = defaultInitialBackoff
+	}
+	for i := 0; i < attempt && d < defaultMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > defaultMaxBackoff {
+		d = defaultMaxBackoff
+	}
+	return d
+}
+
+func (s *Scheduler) maxRetries() int {
+	if s.MaxRetries <= 0 {
+		return defaultMaxRetries
+	}
+	return s.MaxRetries
+}
+
+func (s *Scheduler) wait(ctx context.Context, d time.Duration) error {
+	after := s.after
+	if after == nil {
+		after = time.After
+	}
+	select {
+	case <-after(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck // Want passthrough
+	}
+}
+
+func (s *Scheduler) nowFunc() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
+func (s *Scheduler) randFunc() float64 {
+	if s.rand == nil {
+		return rand.Float64() //nolint:gosec // Jitter doesn't need to be secure.
+	}
+	return s.rand()
+}
@@ -0,0 +1,181 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScheduler_Next(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		scheduler *Scheduler
+		expiry    time.Time
+		want      time.Duration
+	}{
+		{
+			name:      "unknown expiry uses interval",
+			scheduler: &Scheduler{Interval: 5 * time.Minute},
+			want:      5 * time.Minute,
+		},
+		{
+			name:      "default fraction of remaining lifetime",
+			scheduler: &Scheduler{Interval: 5 * time.Minute},
+			expiry:    now.Add(time.Hour),
+			want:      30 * time.Minute,
+		},
+		{
+			name:      "custom fraction",
+			scheduler: &Scheduler{Fraction: 0.75},
+			expiry:    now.Add(time.Hour),
+			want:      45 * time.Minute,
+		},
+		{
+			name:      "max jitter",
+			scheduler: &Scheduler{Jitter: 0.2, rand: func() float64 { return 1 }},
+			expiry:    now.Add(time.Hour),
+			want:      36 * time.Minute,
+		},
+		{
+			name:      "min jitter",
+			scheduler: &Scheduler{Jitter: 0.2, rand: func() float64 { return 0 }},
+			expiry:    now.Add(time.Hour),
+			want:      24 * time.Minute,
+		},
+		{
+			name:      "already expired",
+			scheduler: &Scheduler{},
+			expiry:    now.Add(-time.Minute),
+			want:      minDelay,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.scheduler.now = func() time.Time { return now }
+			if tc.scheduler.rand == nil {
+				tc.scheduler.rand = func() float64 { return 0.5 }
+			}
+			if got := tc.scheduler.Next(tc.expiry); got != tc.want {
+				t.Errorf("Next() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		maxRetries  int
+		results     []error
+		wantCalls   int
+		wantWaits   []time.Duration
+		wantErr     string
+		wantContext bool
+	}{
+		{
+			name:        "refresh until context done",
+			results:     []error{nil, nil},
+			wantCalls:   2,
+			wantWaits:   []time.Duration{time.Hour, time.Hour, time.Hour},
+			wantContext: true,
+		},
+		{
+			name:        "retry transient failures",
+			maxRetries:  3,
+			results:     []error{errors.New("transient"), errors.New("transient"), nil},
+			wantCalls:   3,
+			wantWaits:   []time.Duration{time.Hour, time.Second, 2 * time.Second, time.Hour},
+			wantContext: true,
+		},
+		{
+			name:       "give up after retries",
+			maxRetries: 2,
+			results:    []error{errors.New("e1"), errors.New("e2"), errors.New("e3")},
+			wantCalls:  3,
+			wantWaits:  []time.Duration{time.Hour, time.Second, 2 * time.Second},
+			wantErr:    "giving up after 2 retries: e3",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var waits []time.Duration
+			s := &Scheduler{
+				Interval:   time.Hour,
+				MaxRetries: tc.maxRetries,
+				rand:       func() float64 { return 0.5 },
+				after: func(d time.Duration) <-chan time.Time {
+					waits = append(waits, d)
+					ch := make(chan time.Time, 1)
+					if len(waits) > len(tc.wantWaits)-1 && tc.wantContext {
+						// Stop after the last expected wait.
+						cancel()
+						return ch
+					}
+					ch <- time.Time{}
+					return ch
+				},
+			}
+
+			var calls int
+			err := s.Run(ctx, time.Time{}, func(context.Context) (time.Time, error) {
+				err := tc.results[calls]
+				calls++
+				return time.Time{}, err
+			})
+
+			wantErr := tc.wantErr
+			if tc.wantContext {
+				wantErr = context.Canceled.Error()
+			}
+			if diff := testutil.DiffErrString(err, wantErr); diff != "" {
+				t.Errorf("Run() unexpected error: %s", diff)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("refresh called %d times, want %d", calls, tc.wantCalls)
+			}
+			if diff := cmp.Diff(tc.wantWaits, waits); diff != "" {
+				t.Errorf("waits (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	if err := ValidateInterval(MinInterval); err != nil {
+		t.Errorf("ValidateInterval(%v) error = %v", MinInterval, err)
+	}
+	if err := ValidateInterval(time.Minute); err == nil {
+		t.Errorf("ValidateInterval(%v) got no error", time.Minute)
+	}
+	for _, f := range []float64{0, DefaultFraction, 0.99} {
+		if err := ValidateFraction(f); err != nil {
+			t.Errorf("ValidateFraction(%v) error = %v", f, err)
+		}
+	}
+	for _, f := range []float64{-0.1, 1, 1.5} {
+		if err := ValidateFraction(f); err == nil {
+			t.Errorf("ValidateFraction(%v) got no error", f)
+		}
+	}
+}